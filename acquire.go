@@ -0,0 +1,88 @@
+package gorm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	refMu   sync.Mutex
+	refCond = sync.NewCond(&refMu)
+	// refs counts the unreleased Acquire calls of each pool, a name may be served by
+	// several pools over time, e.g. after Replace or Close and Get.
+	refs = map[*gorm.DB]int{}
+)
+
+// Acquire returns the connection registered as name and keeps its pool open until the
+// matching Release: Close waits for it, and eviction and Replace close the pool only
+// afterwards. Unknown names return ErrNotFound. Release before closing name from the
+// same goroutine, Close waits 30s for it otherwise.
+func Acquire(name string) (*gorm.DB, error) {
+	// 持有rwl读锁计数, 与Close移除连接互斥
+	rwl.RLock()
+	defer rwl.RUnlock()
+
+	c, ok := dbs[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	refMu.Lock()
+	refs[c.db]++
+	refMu.Unlock()
+
+	c.touch(time.Now())
+	return c.db, nil
+}
+
+// Release releases a previous Acquire, db is the *gorm.DB it returned rather than a
+// session derived from it.
+func Release(db *gorm.DB) {
+	refMu.Lock()
+	defer refMu.Unlock()
+
+	if refs[db] == 0 {
+		return
+	}
+	if refs[db]--; refs[db] == 0 {
+		delete(refs, db)
+		refCond.Broadcast()
+	}
+}
+
+func (c *connection) acquired() bool {
+	refMu.Lock()
+	defer refMu.Unlock()
+
+	return refs[c.db] > 0
+}
+
+// waitReleased blocks until every Acquire of the pool of c is released or ctx is done.
+func (c *connection) waitReleased(ctx context.Context) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// 持有refMu广播, 不会错过正在进入Wait的等待者
+			refMu.Lock()
+			refCond.Broadcast()
+			refMu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	refMu.Lock()
+	defer refMu.Unlock()
+
+	for refs[c.db] > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		refCond.Wait()
+	}
+	return nil
+}
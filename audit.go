@@ -0,0 +1,98 @@
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuditRecord describes a create, update or delete statement. SQL keeps placeholders,
+// parameters are never recorded.
+type AuditRecord struct {
+	Time         time.Time
+	Connection   string
+	Operation    string
+	Table        string
+	PrimaryKeys  []interface{}
+	RowsAffected int64
+	SQL          string
+	TraceID      string
+	Err          error
+}
+
+// AuditSink receives write statements for retention, separately from debug logs.
+type AuditSink interface {
+	Audit(ctx context.Context, r AuditRecord)
+}
+
+// AuditLogger writes audit records to l at INFO.
+func AuditLogger(l Logger) AuditSink {
+	return auditLogger{l: l}
+}
+
+type auditLogger struct {
+	l Logger
+}
+
+func (a auditLogger) Audit(ctx context.Context, r AuditRecord) {
+	a.l.Infof(ctx, "[gorm audit] connection:%s operation:%s table:%s pks:%v rows: %d err: %v sql: %s",
+		r.Connection, r.Operation, r.Table, r.PrimaryKeys, r.RowsAffected, r.Err, r.SQL)
+}
+
+func (op *OpentracingPlugin) audit(ctx context.Context, db *gorm.DB, operation string) {
+	r := AuditRecord{
+		Time:         time.Now(),
+		Connection:   op.opt.connectionName,
+		Operation:    operation,
+		Table:        db.Statement.Table,
+		PrimaryKeys:  primaryKeys(ctx, db.Statement),
+		RowsAffected: db.RowsAffected,
+		SQL:          statementSQL(db),
+		Err:          db.Error,
+	}
+	if traceID, _, ok := spanIDs(ctx); ok {
+		r.TraceID = traceID
+	}
+
+	op.opt.auditSink.Audit(ctx, r)
+}
+
+// primaryKeys collects non zero primary keys of the statement model, composite keys are
+// returned as []interface{} per row.
+func primaryKeys(ctx context.Context, stmt *gorm.Statement) []interface{} {
+	if stmt.Schema == nil || len(stmt.Schema.PrimaryFields) == 0 || !stmt.ReflectValue.IsValid() {
+		return nil
+	}
+
+	var keys []interface{}
+	rowKey := func(rv reflect.Value) {
+		values := make([]interface{}, 0, len(stmt.Schema.PrimaryFields))
+		for _, field := range stmt.Schema.PrimaryFields {
+			v, zero := field.ValueOf(ctx, rv)
+			if zero {
+				return
+			}
+			values = append(values, v)
+		}
+		if len(values) == 1 {
+			keys = append(keys, values[0])
+		} else {
+			keys = append(keys, values)
+		}
+	}
+
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if row := reflect.Indirect(rv.Index(i)); row.Kind() == reflect.Struct {
+				rowKey(row)
+			}
+		}
+	case reflect.Struct:
+		rowKey(rv)
+	}
+
+	return keys
+}
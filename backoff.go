@@ -0,0 +1,47 @@
+package gorm
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// backoff doubles the delay after each attempt, from initial up to max.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+// delay returns the wait before retry attempt, starting at 1.
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.initial
+	for i := 1; i < attempt && d < b.max; i++ {
+		d *= 2
+	}
+	if b.max > 0 && d > b.max {
+		d = b.max
+	}
+	return d
+}
+
+// jitter returns a random delay in [d/2, d], so that retries of concurrent callers
+// spread out.
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package gorm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := backoff{initial: 100 * time.Millisecond, max: time.Second}
+	testSuites := map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		20: time.Second,
+	}
+
+	for attempt, expected := range testSuites {
+		if got := b.delay(attempt); got != expected {
+			t.Errorf("delay %v, expects %v, but got %v", attempt, expected, got)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 10 * time.Millisecond, time.Second} {
+		for i := 0; i < 100; i++ {
+			if got := jitter(d); got < d/2 || got > d {
+				t.Errorf("jitter %v, expects between %v and %v, but got %v", d, d/2, d, got)
+			}
+		}
+	}
+}
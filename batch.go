@@ -0,0 +1,80 @@
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+var (
+	_batchIndexKey = keyWithPrefix("batch.index")
+	_batchSizeKey  = keyWithPrefix("batch.size")
+)
+
+type batchTrackerKey struct{}
+
+type batchTracker struct {
+	umbrella trace.Span
+	index    int64
+}
+
+// CreateInBatches runs db.CreateInBatches under an umbrella span, each batch INSERT gets its
+// own span linked to it, carrying the batch index and size.
+func CreateInBatches(ctx context.Context, db *gorm.DB, value interface{}, batchSize int) *gorm.DB {
+	op, ok := lookupPlugin(db)
+	if !ok || !op.tracing(ctx) {
+		return db.WithContext(ctx).CreateInBatches(value, batchSize)
+	}
+
+	ctx, span := op.startSpan(ctx, db, _createBatchesOp)
+	defer span.End()
+	span.SetAttributes(attribute.Int(_batchSizeKey, batchSize))
+
+	ctx = context.WithValue(ctx, batchTrackerKey{}, &batchTracker{umbrella: span})
+	tx := db.WithContext(ctx).CreateInBatches(value, batchSize)
+
+	if op.isSpanError(tx.Error) {
+		op.opt.errorTagHook(span, tx.Error)
+	}
+	span.SetAttributes(attribute.Int64(_rowsAffectedLogKey, tx.RowsAffected))
+
+	return tx
+}
+
+// batchSpan returns the link and attributes of a batch INSERT started directly under a
+// CreateInBatches umbrella span, association inserts nested deeper are not batches.
+func batchSpan(ctx context.Context, stmt *gorm.Statement) ([]trace.SpanStartOption, []attribute.KeyValue) {
+	tracker, ok := ctx.Value(batchTrackerKey{}).(*batchTracker)
+	if !ok || !sameSpan(trace.SpanFromContext(ctx), tracker.umbrella) {
+		return nil, nil
+	}
+
+	size := 1
+	if stmt.ReflectValue.Kind() == reflect.Slice || stmt.ReflectValue.Kind() == reflect.Array {
+		size = stmt.ReflectValue.Len()
+	}
+
+	var opts []trace.SpanStartOption
+	if sc := tracker.umbrella.SpanContext(); sc.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+	}
+	attrs := []attribute.KeyValue{
+		attribute.Int64(_batchIndexKey, atomic.AddInt64(&tracker.index, 1)-1),
+		attribute.Int(_batchSizeKey, size),
+	}
+
+	return opts, attrs
+}
+
+// sameSpan compares span contexts, or the spans themselves for OpenTracing and Datadog
+// spans, which have none.
+func sameSpan(a, b trace.Span) bool {
+	if sc := b.SpanContext(); sc.IsValid() {
+		return sc.Equal(a.SpanContext())
+	}
+	return reflect.TypeOf(b).Comparable() && a == b
+}
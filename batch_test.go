@@ -0,0 +1,30 @@
+package gorm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+func TestBatchSpan(t *testing.T) {
+	// 没有span context的span, 如OpenTracing和Datadog的span
+	umbrella := &attrSpan{Span: trace.SpanFromContext(context.Background())}
+	nested := &attrSpan{Span: trace.SpanFromContext(context.Background())}
+	ctx := context.WithValue(context.Background(), batchTrackerKey{}, &batchTracker{umbrella: umbrella})
+
+	testSuites := map[*attrSpan]bool{
+		umbrella: true,
+		nested:   false,
+	}
+
+	for span, expected := range testSuites {
+		stmt := &gorm.Statement{ReflectValue: reflect.ValueOf([]int{1, 2})}
+		_, attrs := batchSpan(trace.ContextWithSpan(ctx, span), stmt)
+		if got := attrs != nil; got != expected {
+			t.Errorf("batchSpan under umbrella %v, expects %v, but got %v", span == umbrella, expected, got)
+		}
+	}
+}
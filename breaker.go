@@ -0,0 +1,428 @@
+package gorm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	_breakerPluginName = "otel:breaker"
+
+	_breakerStartInstance   = "breaker_start"
+	_breakerCircuitInstance = "breaker_circuit"
+	_breakerProbeInstance   = "breaker_probe"
+
+	// _breakerBuckets 滑动窗口的分桶数
+	_breakerBuckets = 10
+)
+
+var (
+	// ErrCircuitOpen fails the statements CircuitBreaker rejects without running them.
+	ErrCircuitOpen = errors.New("gorm: circuit open")
+	// ErrBreakerOption is returned by db.Use for a CircuitBreaker with invalid options.
+	ErrBreakerOption = errors.New("gorm: invalid circuit breaker option")
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
+// CircuitBreaker is a gorm plugin failing statements fast with ErrCircuitOpen while the
+// database of the connection looks sick, so that callers don't pile up on it. Each pool
+// statements run on, e.g. the primary and every replica of WithReplicas, has its own
+// circuit. A circuit opens when the share of failed or slow statements over the window
+// crosses its threshold, rejects statements for the open timeout, then lets a few probes
+// through: it closes if they all succeed and opens again otherwise, or if they don't
+// finish within the open timeout. Not found, constraint and syntax errors are the
+// caller's and don't count as failures, cancelled statements don't count at all.
+type CircuitBreaker struct {
+	window        time.Duration
+	minRequests   int64
+	errorRate     float64
+	slowThreshold time.Duration
+	slowRate      float64
+	openTimeout   time.Duration
+	probes        int
+	onStateChange func(conn string, pool gorm.ConnPool, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[gorm.ConnPool]*circuit
+}
+
+// circuit is the state of the breaker for one pool.
+type circuit struct {
+	b    *CircuitBreaker
+	conn string
+	pool gorm.ConnPool
+
+	mu       sync.Mutex
+	state    CircuitState
+	changes  []circuitChange
+	openedAt time.Time
+	// probedAt is when the half open state started, generation counts them so that
+	// probes finishing late don't count for the next one.
+	probedAt   time.Time
+	generation int64
+	inflight   int
+	passed     int
+	buckets    [_breakerBuckets]breakerBucket
+}
+
+// circuitChange is a state change made under circuit.mu, reported after unlocking it.
+type circuitChange struct {
+	from, to CircuitState
+}
+
+// breakerOutcome is how a statement counts for the circuit of its pool.
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	breakerIgnored
+)
+
+type breakerBucket struct {
+	start    time.Time
+	total    int64
+	failures int64
+	slow     int64
+}
+
+// BreakerOption configures NewCircuitBreaker.
+type BreakerOption func(b *CircuitBreaker)
+
+// WithBreakerErrorRate opens the circuit when at least rate of the statements of the
+// window failed, once the window has minRequests statements. Defaults to 0.5 and 20.
+func WithBreakerErrorRate(rate float64, minRequests int) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.errorRate, b.minRequests = rate, int64(minRequests)
+	}
+}
+
+// WithBreakerLatency opens the circuit when at least rate of the statements of the
+// window took threshold or longer. Disabled by default.
+func WithBreakerLatency(threshold time.Duration, rate float64) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.slowThreshold, b.slowRate = threshold, rate
+	}
+}
+
+// WithBreakerWindow sets the sliding window rates are computed over, 10s by default.
+func WithBreakerWindow(d time.Duration) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.window = d
+	}
+}
+
+// WithBreakerOpenTimeout sets how long the circuit rejects statements before probing,
+// and how many probes have to succeed to close it. Defaults to 5s and 3.
+func WithBreakerOpenTimeout(d time.Duration, probes int) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.openTimeout, b.probes = d, probes
+	}
+}
+
+// WithBreakerStateChange calls fn when a circuit changes state, e.g. to log or count it.
+// conn identifies the connection, its registry name or else its dialect and a hash of its
+// DSN, pool is the pool of the circuit, e.g. one of its replicas. fn runs outside of the
+// lock of the circuit, so it may query through the breaker or call State.
+func WithBreakerStateChange(fn func(conn string, pool gorm.ConnPool, from, to CircuitState)) BreakerOption {
+	return func(b *CircuitBreaker) {
+		b.onStateChange = fn
+	}
+}
+
+// NewCircuitBreaker creates the circuit breaker of a connection, register it with db.Use
+// or WithPlugins, which fail with ErrBreakerOption if the options are invalid.
+func NewCircuitBreaker(opts ...BreakerOption) *CircuitBreaker {
+	b := &CircuitBreaker{
+		window:      10 * time.Second,
+		minRequests: 20,
+		errorRate:   0.5,
+		openTimeout: 5 * time.Second,
+		probes:      3,
+		circuits:    map[gorm.ConnPool]*circuit{},
+	}
+	for _, apply := range opts {
+		apply(b)
+	}
+	return b
+}
+
+// validate reports options the breaker can't work with.
+func (b *CircuitBreaker) validate() error {
+	switch {
+	case b.window < _breakerBuckets:
+		return fmt.Errorf("%w: window %v is shorter than %dns", ErrBreakerOption, b.window, _breakerBuckets)
+	case b.errorRate <= 0 || b.errorRate > 1:
+		return fmt.Errorf("%w: error rate %v is not in (0, 1]", ErrBreakerOption, b.errorRate)
+	case b.minRequests < 1:
+		return fmt.Errorf("%w: min requests %d is less than 1", ErrBreakerOption, b.minRequests)
+	case b.slowRate < 0 || b.slowRate > 1 || b.slowThreshold < 0:
+		return fmt.Errorf("%w: latency threshold %v or rate %v is out of range", ErrBreakerOption, b.slowThreshold, b.slowRate)
+	case b.openTimeout <= 0:
+		return fmt.Errorf("%w: open timeout %v is not positive", ErrBreakerOption, b.openTimeout)
+	case b.probes < 1:
+		return fmt.Errorf("%w: probes %d is less than 1", ErrBreakerOption, b.probes)
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) Name() string {
+	return _breakerPluginName
+}
+
+func (b *CircuitBreaker) Initialize(db *gorm.DB) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+
+	var e myError
+
+	e.add(_stageBeforeCreate, db.Callback().Create().Before("gorm:create").Register(_breakerPluginName+":before_create", b.before))
+	e.add(_stageAfterCreate, db.Callback().Create().After("gorm:create").Register(_breakerPluginName+":after_create", b.after))
+	e.add(_stageBeforeQuery, db.Callback().Query().Before("gorm:query").Register(_breakerPluginName+":before_query", b.before))
+	e.add(_stageAfterQuery, db.Callback().Query().After("gorm:query").Register(_breakerPluginName+":after_query", b.after))
+	e.add(_stageBeforeUpdate, db.Callback().Update().Before("gorm:update").Register(_breakerPluginName+":before_update", b.before))
+	e.add(_stageAfterUpdate, db.Callback().Update().After("gorm:update").Register(_breakerPluginName+":after_update", b.after))
+	e.add(_stageBeforeDelete, db.Callback().Delete().Before("gorm:delete").Register(_breakerPluginName+":before_delete", b.before))
+	e.add(_stageAfterDelete, db.Callback().Delete().After("gorm:delete").Register(_breakerPluginName+":after_delete", b.after))
+	e.add(_stageBeforeRow, db.Callback().Row().Before("gorm:row").Register(_breakerPluginName+":before_row", b.before))
+	e.add(_stageAfterRow, db.Callback().Row().After("gorm:row").Register(_breakerPluginName+":after_row", b.after))
+	e.add(_stageBeforeRaw, db.Callback().Raw().Before("gorm:raw").Register(_breakerPluginName+":before_raw", b.before))
+	e.add(_stageAfterRaw, db.Callback().Raw().After("gorm:raw").Register(_breakerPluginName+":after_raw", b.after))
+
+	return e.toError()
+}
+
+func (b *CircuitBreaker) before(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+
+	now := time.Now()
+	c := b.circuit(db)
+	ok, probe := c.allow(now)
+	if !ok {
+		_ = db.AddError(ErrCircuitOpen)
+		return
+	}
+	db.InstanceSet(_breakerStartInstance, now)
+	db.InstanceSet(_breakerCircuitInstance, c)
+	db.InstanceSet(_breakerProbeInstance, probe)
+}
+
+func (b *CircuitBreaker) after(db *gorm.DB) {
+	v, ok := db.InstanceGet(_breakerStartInstance)
+	if !ok {
+		return
+	}
+	start, _ := v.(time.Time)
+	v, _ = db.InstanceGet(_breakerCircuitInstance)
+	c, ok := v.(*circuit)
+	if !ok {
+		return
+	}
+	v, _ = db.InstanceGet(_breakerProbeInstance)
+	probe, _ := v.(int64)
+
+	now := time.Now()
+	c.record(now, probe, breakerOutcomeOf(db.Error), now.Sub(start))
+}
+
+// circuit returns the circuit of the pool the statement runs on, statements in a
+// transaction count for the pool it was begun on.
+func (b *CircuitBreaker) circuit(db *gorm.DB) *circuit {
+	pool := db.Statement.ConnPool
+	if _, inTx := pool.(gorm.TxCommitter); inTx || pool == nil {
+		pool = db.ConnPool
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[pool]
+	if !ok {
+		c = &circuit{b: b, conn: cacheScope(db), pool: pool}
+		b.circuits[pool] = c
+	}
+	return c
+}
+
+// State returns the state of the circuit of pool, CircuitClosed if no statement ran on it.
+func (b *CircuitBreaker) State(pool gorm.ConnPool) CircuitState {
+	b.mu.Lock()
+	c, ok := b.circuits[pool]
+	b.mu.Unlock()
+	if !ok {
+		return CircuitClosed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// breakerOutcomeOf tells errors hinting at a sick database from those of a bad statement,
+// cancellations say nothing about the database.
+func breakerOutcomeOf(err error) breakerOutcome {
+	if err == nil || errors.Is(err, ErrCircuitOpen) {
+		return breakerSuccess
+	}
+
+	switch classifyError(err) {
+	case ErrClassCanceled:
+		return breakerIgnored
+	case ErrClassNotFound, ErrClassDuplicateKey, ErrClassForeignKey, ErrClassDataTooLong,
+		ErrClassSyntax, ErrClassNoSuchTable:
+		return breakerSuccess
+	}
+	return breakerFailure
+}
+
+// allow reports whether a statement may run, and if it is a half open probe the
+// generation of its half open state, 0 otherwise.
+func (c *circuit) allow(now time.Time) (ok bool, probe int64) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	switch c.state {
+	case CircuitOpen:
+		if now.Sub(c.openedAt) < c.b.openTimeout {
+			return false, 0
+		}
+		c.setState(CircuitHalfOpen)
+		c.probedAt, c.inflight, c.passed = now, 0, 0
+		c.generation++
+		fallthrough
+	case CircuitHalfOpen:
+		if c.inflight+c.passed >= c.b.probes {
+			// 探测超过打开时长仍未结束, 例如after没有执行, 视为失败
+			if c.inflight > 0 && now.Sub(c.probedAt) >= c.b.openTimeout {
+				c.open(now)
+			}
+			return false, 0
+		}
+		c.inflight++
+		return true, c.generation
+	}
+	return true, 0
+}
+
+func (c *circuit) record(now time.Time, probe int64, outcome breakerOutcome, cost time.Duration) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	slow := c.b.slowThreshold > 0 && cost >= c.b.slowThreshold
+	failed := outcome == breakerFailure
+	if probe != 0 {
+		if c.state != CircuitHalfOpen || probe != c.generation {
+			return
+		}
+		c.inflight--
+		if outcome == breakerIgnored {
+			// 取消的探测不说明数据库状态, 让出名额
+			return
+		}
+		if failed || slow {
+			c.open(now)
+			return
+		}
+		// 探测全部成功后关闭, 丢弃打开前的统计
+		if c.passed++; c.passed >= c.b.probes {
+			c.buckets = [_breakerBuckets]breakerBucket{}
+			c.setState(CircuitClosed)
+		}
+		return
+	}
+	if c.state != CircuitClosed || outcome == breakerIgnored {
+		return
+	}
+
+	bucket := c.bucket(now)
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	total, failures, slows := c.totals(now)
+	if total < c.b.minRequests {
+		return
+	}
+	if float64(failures) >= c.b.errorRate*float64(total) || (c.b.slowRate > 0 && float64(slows) >= c.b.slowRate*float64(total)) {
+		c.open(now)
+	}
+}
+
+// bucket returns the bucket of now, resetting it if it belongs to a past window.
+func (c *circuit) bucket(now time.Time) *breakerBucket {
+	width := c.b.window / _breakerBuckets
+	start := now.Truncate(width)
+	bucket := &c.buckets[int(start.UnixNano()/int64(width))%_breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+func (c *circuit) totals(now time.Time) (total, failures, slow int64) {
+	for _, bucket := range c.buckets {
+		if now.Sub(bucket.start) < c.b.window {
+			total += bucket.total
+			failures += bucket.failures
+			slow += bucket.slow
+		}
+	}
+	return total, failures, slow
+}
+
+func (c *circuit) open(now time.Time) {
+	c.openedAt = now
+	c.setState(CircuitOpen)
+}
+
+// setState changes the state, the caller holds c.mu and reports the change with unlock.
+func (c *circuit) setState(state CircuitState) {
+	if c.state == state {
+		return
+	}
+	if c.b.onStateChange != nil {
+		c.changes = append(c.changes, circuitChange{from: c.state, to: state})
+	}
+	c.state = state
+}
+
+// unlock releases c.mu, then calls the state change callback for the changes made while
+// it was held.
+func (c *circuit) unlock() {
+	changes := c.changes
+	c.changes = nil
+	c.mu.Unlock()
+
+	for _, change := range changes {
+		c.b.onStateChange(c.conn, c.pool, change.from, change.to)
+	}
+}
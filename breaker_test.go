@@ -0,0 +1,204 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func outcome(failed bool) breakerOutcome {
+	if failed {
+		return breakerFailure
+	}
+	return breakerSuccess
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	c := &circuit{b: NewCircuitBreaker(WithBreakerErrorRate(0.5, 4), WithBreakerOpenTimeout(time.Second, 2))}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 4; i++ {
+		if ok, _ := c.allow(now); !ok {
+			t.Errorf("allow %d, expects %v, but got %v", i, true, ok)
+		}
+		c.record(now, 0, outcome(i%2 == 0), time.Millisecond)
+	}
+	if c.state != CircuitOpen {
+		t.Errorf("state after failures, expects %v, but got %v", CircuitOpen, c.state)
+	}
+	if ok, _ := c.allow(now.Add(500 * time.Millisecond)); ok {
+		t.Errorf("allow while open, expects %v, but got %v", false, ok)
+	}
+
+	now = now.Add(time.Second)
+	probes := make([]int64, 2)
+	for i := range probes {
+		ok, probe := c.allow(now)
+		if !ok || probe == 0 {
+			t.Errorf("probe %d, expects %v, but got %v", i, true, ok && probe != 0)
+		}
+		probes[i] = probe
+	}
+	if ok, _ := c.allow(now); ok {
+		t.Errorf("allow beyond probes, expects %v, but got %v", false, ok)
+	}
+	c.record(now, probes[0], breakerSuccess, time.Millisecond)
+	c.record(now, probes[1], breakerFailure, time.Millisecond)
+	if c.state != CircuitOpen {
+		t.Errorf("state after failed probe, expects %v, but got %v", CircuitOpen, c.state)
+	}
+
+	now = now.Add(time.Second)
+	for i := range probes {
+		_, probes[i] = c.allow(now)
+	}
+	c.record(now, probes[0], breakerSuccess, time.Millisecond)
+	c.record(now, probes[1], breakerSuccess, time.Millisecond)
+	if c.state != CircuitClosed {
+		t.Errorf("state after probes, expects %v, but got %v", CircuitClosed, c.state)
+	}
+}
+
+func TestCircuitBreakerProbes(t *testing.T) {
+	c := &circuit{b: NewCircuitBreaker(WithBreakerOpenTimeout(time.Second, 1))}
+	now := time.Unix(1000, 0)
+	c.open(now)
+
+	// 取消的探测让出名额, 不关闭
+	now = now.Add(time.Second)
+	_, probe := c.allow(now)
+	c.record(now, probe, breakerOutcomeOf(context.Canceled), time.Millisecond)
+	if c.state != CircuitHalfOpen {
+		t.Errorf("state after cancelled probe, expects %v, but got %v", CircuitHalfOpen, c.state)
+	}
+
+	// 没有结束的探测超过打开时长后重新打开
+	ok, abandoned := c.allow(now)
+	if !ok {
+		t.Errorf("allow after cancelled probe, expects %v, but got %v", true, ok)
+	}
+	if ok, _ = c.allow(now.Add(time.Second)); ok || c.state != CircuitOpen {
+		t.Errorf("state after abandoned probe, expects %v, but got %v", CircuitOpen, c.state)
+	}
+
+	// 上一轮的探测迟到时不计入
+	now = now.Add(2 * time.Second)
+	_, probe = c.allow(now)
+	c.record(now, abandoned, breakerFailure, time.Millisecond)
+	if c.state != CircuitHalfOpen {
+		t.Errorf("state after late probe, expects %v, but got %v", CircuitHalfOpen, c.state)
+	}
+	c.record(now, probe, breakerSuccess, time.Millisecond)
+	if c.state != CircuitClosed {
+		t.Errorf("state after probe, expects %v, but got %v", CircuitClosed, c.state)
+	}
+}
+
+func TestCircuitBreakerLatency(t *testing.T) {
+	c := &circuit{b: NewCircuitBreaker(WithBreakerErrorRate(0.5, 2), WithBreakerLatency(time.Second, 0.5))}
+	now := time.Unix(1000, 0)
+
+	c.record(now, 0, breakerSuccess, 2*time.Second)
+	c.record(now.Add(20*time.Second), 0, breakerSuccess, 2*time.Second)
+	if c.state != CircuitClosed {
+		t.Errorf("state across windows, expects %v, but got %v", CircuitClosed, c.state)
+	}
+	c.record(now.Add(21*time.Second), 0, breakerSuccess, 2*time.Second)
+	if c.state != CircuitOpen {
+		t.Errorf("state after slow calls, expects %v, but got %v", CircuitOpen, c.state)
+	}
+}
+
+func TestCircuitBreakerPools(t *testing.T) {
+	b := NewCircuitBreaker()
+	primary, replica := &txPool{}, &txPool{}
+	db := &gorm.DB{Config: &gorm.Config{ConnPool: primary, Dialector: sqlite.Open("orders.db")}, Statement: &gorm.Statement{ConnPool: primary}}
+	tx := &gorm.DB{Config: db.Config, Statement: &gorm.Statement{ConnPool: &txConn{txPool: primary}}}
+	read := &gorm.DB{Config: db.Config, Statement: &gorm.Statement{ConnPool: replica}}
+
+	if b.circuit(db) != b.circuit(tx) {
+		t.Errorf("circuit of a transaction, expects the one of its pool")
+	}
+	if b.circuit(db) == b.circuit(read) {
+		t.Errorf("circuit of a replica, expects its own")
+	}
+}
+
+func TestCircuitBreakerStateChange(t *testing.T) {
+	type change struct {
+		conn     string
+		pool     gorm.ConnPool
+		from, to CircuitState
+		state    CircuitState
+	}
+	var b *CircuitBreaker
+	var changes []change
+	b = NewCircuitBreaker(WithBreakerErrorRate(0.5, 2), WithBreakerStateChange(func(conn string, pool gorm.ConnPool, from, to CircuitState) {
+		// 回调里再进入熔断器不能死锁
+		changes = append(changes, change{conn: conn, pool: pool, from: from, to: to, state: b.State(pool)})
+	}))
+	pool := &txPool{}
+	db := &gorm.DB{Config: &gorm.Config{ConnPool: pool, Dialector: sqlite.Open("orders.db")}, Statement: &gorm.Statement{ConnPool: pool}}
+	c := b.circuit(db)
+	now := time.Unix(1000, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2; i++ {
+			c.allow(now)
+			c.record(now, 0, breakerFailure, time.Millisecond)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("state change callback deadlocked")
+	}
+
+	expected := change{conn: cacheScope(db), pool: pool, from: CircuitClosed, to: CircuitOpen, state: CircuitOpen}
+	if len(changes) != 1 || changes[0] != expected {
+		t.Errorf("state changes, expects %v, but got %v", []change{expected}, changes)
+	}
+}
+
+func TestCircuitBreakerOptions(t *testing.T) {
+	testSuites := map[string]*CircuitBreaker{
+		"window":       NewCircuitBreaker(WithBreakerWindow(time.Nanosecond)),
+		"probes":       NewCircuitBreaker(WithBreakerOpenTimeout(time.Second, 0)),
+		"open timeout": NewCircuitBreaker(WithBreakerOpenTimeout(0, 3)),
+		"error rate":   NewCircuitBreaker(WithBreakerErrorRate(0, 20)),
+		"slow rate":    NewCircuitBreaker(WithBreakerLatency(time.Second, 2)),
+	}
+
+	for name, b := range testSuites {
+		if err := b.validate(); !errors.Is(err, ErrBreakerOption) {
+			t.Errorf("validate %v, expects %v, but got %v", name, ErrBreakerOption, err)
+		}
+	}
+	if err := NewCircuitBreaker().validate(); err != nil {
+		t.Errorf("validate defaults, expects no error, but got %v", err)
+	}
+}
+
+func TestBreakerOutcome(t *testing.T) {
+	testSuites := map[error]breakerOutcome{
+		nil:                               breakerSuccess,
+		gorm.ErrRecordNotFound:            breakerSuccess,
+		&gomysql.MySQLError{Number: 1062}: breakerSuccess,
+		context.Canceled:                  breakerIgnored,
+		context.DeadlineExceeded:          breakerFailure,
+		&gomysql.MySQLError{Number: 1040}: breakerFailure,
+	}
+
+	for err, expected := range testSuites {
+		if got := breakerOutcomeOf(err); got != expected {
+			t.Errorf("breakerOutcomeOf %v, expects %v, but got %v", err, expected, got)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/driver/clickhouse"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormcallbacks "gorm.io/gorm/callbacks"
+)
+
+const (
+	_cachePluginName = "otel:cache"
+	_cacheHitKey     = attribute.Key("cache.hit")
+
+	// _cacheHitInstance 缓存插件记录命中情况, 由追踪插件写入span
+	_cacheHitInstance = "cache_hit"
+	// _cacheScopeInstance 语句所在连接的标识, 缓存和合并查询的key都带上它
+	_cacheScopeInstance = "cache_scope"
+
+	_defaultCacheSize = 10000
+)
+
+// QueryCache is a gorm plugin serving repeated queries of read mostly tables from memory,
+// or a shared CacheBackend, without touching the database, e.g. lookup tables. Results
+// are keyed by the connection, i.e. its registry name or else its dialect and DSN, the
+// normalized SQL, its parameters and the destination type, and kept for the TTL of their
+// table, so one QueryCache can be shared by several pools. Queries in transactions or locking rows are never cached.
+// Creates, updates and deletes through gorm invalidate the results of their table once
+// committed, raw statements and queries joining other tables rely on the TTL. Writes in
+// transactions not begun with Transaction invalidate before their commit, a query racing
+// them may cache the old rows again until their TTL. The in-memory backend has the same
+// race with every write, a query that read the old rows before an invalidation stores
+// them after it, RedisCache doesn't. Register it after the tracing plugin, whose query
+// spans then carry cache.hit.
+type QueryCache struct {
+	defaultTTL time.Duration
+	tableTTLs  map[string]time.Duration
+	size       int
+
+	backend CacheBackend
+}
+
+// CacheBackend stores encoded query results, e.g. NewRedisCache to share them between
+// the instances of a service. Errors are treated as misses.
+type CacheBackend interface {
+	// Get returns the result stored under key, and the token Set stores the result of the
+	// query run on a miss with, e.g. the version of the table read before the query.
+	Get(ctx context.Context, key string) (value []byte, ok bool, token string, err error)
+	// Set stores value unless the results read with token were invalidated since.
+	Set(ctx context.Context, key, token string, value []byte, ttl time.Duration) error
+	// Invalidate drops the results of table, their keys start with table + ":".
+	Invalidate(ctx context.Context, table string) error
+}
+
+// cachedResult is what backends store, Dest is gob encoded.
+type cachedResult struct {
+	Rows int64
+	Dest []byte
+}
+
+// CacheOption configures NewQueryCache.
+type CacheOption func(c *QueryCache)
+
+// WithCacheTTL caches queries of every table for ttl, tables without a TTL aren't cached
+// by default.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(c *QueryCache) {
+		c.defaultTTL = ttl
+	}
+}
+
+// WithTableTTL caches queries of table for ttl, overriding WithCacheTTL.
+func WithTableTTL(table string, ttl time.Duration) CacheOption {
+	return func(c *QueryCache) {
+		c.tableTTLs[table] = ttl
+	}
+}
+
+// WithCacheSize bounds the results cached in memory, the least recently used are dropped
+// first. It defaults to 10000.
+func WithCacheSize(n int) CacheOption {
+	return func(c *QueryCache) {
+		c.size = n
+	}
+}
+
+// WithCacheBackend stores results in backend instead of memory.
+func WithCacheBackend(backend CacheBackend) CacheOption {
+	return func(c *QueryCache) {
+		c.backend = backend
+	}
+}
+
+// NewQueryCache creates the caching plugin, register it with db.Use.
+func NewQueryCache(opts ...CacheOption) *QueryCache {
+	c := &QueryCache{tableTTLs: map[string]time.Duration{}, size: _defaultCacheSize}
+	for _, apply := range opts {
+		apply(c)
+	}
+	if c.backend == nil {
+		c.backend = newMemoryCache(c.size)
+	}
+	return c
+}
+
+func (c *QueryCache) Name() string {
+	return _cachePluginName
+}
+
+func (c *QueryCache) Initialize(db *gorm.DB) error {
+	if err := registerCacheScope(db); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Replace("gorm:query", runQuery); err != nil {
+		return err
+	}
+	// 在gorm包装写入的事务提交之后失效
+	if err := db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register(_cachePluginName+":invalidate_create", c.invalidate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register(_cachePluginName+":invalidate_update", c.invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register(_cachePluginName+":invalidate_delete", c.invalidate)
+}
+
+// queryStage answers from the cache when possible.
+func (c *QueryCache) queryStage(db *gorm.DB, next func(db *gorm.DB)) {
+	ttl, ok := c.ttl(db)
+	if !ok || db.Error != nil || db.DryRun {
+		next(db)
+		return
+	}
+
+	gormcallbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+	ctx := db.Statement.Context
+	key := cacheKey(statementScope(db), db.Statement.Table, statementSQL(db), db.Statement.Vars, db.Statement.Dest)
+
+	data, ok, token, err := c.backend.Get(ctx, key)
+	if err == nil && ok {
+		if rows, err := decodeCached(data, db.Statement.Dest); err == nil {
+			db.RowsAffected = rows
+			db.InstanceSet(_cacheHitInstance, true)
+			return
+		}
+	}
+
+	db.InstanceSet(_cacheHitInstance, false)
+	next(db)
+	// 读缓存失败时没有token, 不写入
+	if db.Error != nil || err != nil {
+		return
+	}
+
+	// 无法编码的结果不缓存
+	if data, err := encodeCached(db.Statement.Dest, db.RowsAffected); err == nil {
+		_ = c.backend.Set(ctx, key, token, data, ttl)
+	}
+}
+
+func encodeCached(dest interface{}, rows int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(dest); err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+	err := gob.NewEncoder(&result).Encode(cachedResult{Rows: rows, Dest: buf.Bytes()})
+	return result.Bytes(), err
+}
+
+// decodeCached decodes into a zeroed dest, gob leaves the fields missing from data, i.e.
+// the zero ones, untouched.
+func decodeCached(data []byte, dest interface{}) (int64, error) {
+	var result cachedResult
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&result); err != nil {
+		return 0, err
+	}
+
+	if v := reflect.Indirect(reflect.ValueOf(dest)); v.CanSet() {
+		v.Set(reflect.Zero(v.Type()))
+	}
+	return result.Rows, gob.NewDecoder(bytes.NewReader(result.Dest)).Decode(dest)
+}
+
+// invalidate drops the cached results of the table a write changed, after the commit of
+// the Transaction it runs in.
+func (c *QueryCache) invalidate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.RowsAffected == 0 || db.Statement.Table == "" {
+		return
+	}
+
+	ctx, table := db.Statement.Context, db.Statement.Table
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx && afterCommit(ctx, func() {
+		_ = c.backend.Invalidate(ctx, table)
+	}) {
+		return
+	}
+	_ = c.backend.Invalidate(ctx, table)
+}
+
+// ttl returns how long the results of the statement are cached, if at all.
+func (c *QueryCache) ttl(db *gorm.DB) (time.Duration, bool) {
+	stmt := db.Statement
+	if stmt.Table == "" || !shareable(stmt) {
+		return 0, false
+	}
+
+	ttl, ok := c.tableTTLs[stmt.Table]
+	if !ok {
+		ttl = c.defaultTTL
+	}
+	return ttl, ttl > 0
+}
+
+// shareable reports whether the result of stmt can be served to other statements, i.e.
+// it doesn't depend on a transaction or lock rows.
+func shareable(stmt *gorm.Statement) bool {
+	if stmt.Dest == nil {
+		return false
+	}
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+		return false
+	}
+	_, locking := stmt.Clauses["FOR"]
+	return !locking
+}
+
+// cacheKey hashes the statement with whitespace collapsed. The scope only goes into the
+// hash, writes invalidate the results of their table on every connection.
+func cacheKey(scope, table, sql string, vars []interface{}, dest interface{}) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00", scope, table, strings.Join(strings.Fields(sql), " "), reflect.TypeOf(dest))
+	for _, v := range vars {
+		fmt.Fprintf(h, "%T:%v\x00", v, v)
+	}
+	return table + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// registerCacheScope tags the queries of db with the identity of its connection, once for
+// QueryCache and QueryDedup.
+func registerCacheScope(db *gorm.DB) error {
+	name := _cachePluginName + ":scope"
+	if db.Callback().Query().Get(name) != nil {
+		return nil
+	}
+
+	scope := cacheScope(db)
+	return db.Callback().Query().Before("gorm:query").Register(name, func(db *gorm.DB) {
+		db.InstanceSet(_cacheScopeInstance, scope)
+	})
+}
+
+// cacheScope identifies the connection of db: its registry name, or else its dialect and
+// a hash of its DSN, which may hold a password.
+func cacheScope(db *gorm.DB) string {
+	if op, ok := lookupPlugin(db); ok && op.opt.connectionName != "" {
+		return op.opt.connectionName
+	}
+
+	dsn := dialectorDSN(db.Dialector)
+	if dsn == "" {
+		// 没有DSN时只能区分本进程内的连接池
+		dsn = fmt.Sprintf("%p", db.ConnPool)
+	}
+	h := sha256.Sum256([]byte(dsn))
+	return db.Name() + ":" + hex.EncodeToString(h[:8])
+}
+
+func statementScope(db *gorm.DB) string {
+	scope, _ := db.InstanceGet(_cacheScopeInstance)
+	s, _ := scope.(string)
+	return s
+}
+
+// dialectorDSN returns the DSN d was opened with, it is empty for existing connections.
+func dialectorDSN(d gorm.Dialector) string {
+	switch d := d.(type) {
+	case *mysql.Dialector:
+		if d.Config != nil {
+			return d.DSN
+		}
+	case *postgres.Dialector:
+		if d.Config != nil {
+			return d.DSN
+		}
+	case *clickhouse.Dialector:
+		if d.Config != nil {
+			return d.DSN
+		}
+	case *sqlite.Dialector:
+		return d.DSN
+	}
+	return ""
+}
+
+type cacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// memoryCache holds at most size entries, expired ones are dropped when read.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	recent  *lru
+}
+
+func newMemoryCache(size int) *memoryCache {
+	return &memoryCache{entries: map[string]cacheEntry{}, recent: newLRU(size)}
+}
+
+func (m *memoryCache) Get(_ context.Context, key string) ([]byte, bool, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false, "", nil
+	}
+	if time.Now().After(e.expires) {
+		delete(m.entries, key)
+		m.recent.remove(key)
+		return nil, false, "", nil
+	}
+	m.recent.touch(key)
+	return e.data, true, "", nil
+}
+
+func (m *memoryCache) Set(_ context.Context, key, _ string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = cacheEntry{data: value, expires: time.Now().Add(ttl)}
+	for _, evicted := range m.recent.touch(key) {
+		delete(m.entries, evicted)
+	}
+	return nil
+}
+
+func (m *memoryCache) Invalidate(_ context.Context, table string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefix := table + ":"
+	for key := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.entries, key)
+			m.recent.remove(key)
+		}
+	}
+	return nil
+}
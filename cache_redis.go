@@ -0,0 +1,80 @@
+package gorm
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisCache is a CacheBackend sharing query results through Redis. The keys of a table
+// carry its version, which Invalidate increments instead of deleting them, reads cost one
+// more round trip to get the version. Results are stored under the version read before
+// their query, so a query racing a write doesn't store the old rows under the new one.
+type RedisCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCache stores results under prefix in client, e.g. "gorm:cache:" followed by
+// the service name so services sharing a Redis don't read each other's results.
+func NewRedisCache(client redis.UniversalClient, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+// Get returns the current version of the table of key as token.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, string, error) {
+	version, err := c.version(ctx, key)
+	if err != nil {
+		return nil, false, "", err
+	}
+
+	data, err := c.client.Get(ctx, c.versioned(key, version)).Bytes()
+	if err == redis.Nil {
+		return nil, false, version, nil
+	}
+	if err != nil {
+		return nil, false, "", err
+	}
+	return data, true, version, nil
+}
+
+// Set stores value under the version token returned by Get, it is never read if the
+// table was invalidated in between.
+func (c *RedisCache) Set(ctx context.Context, key, token string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, c.versioned(key, token), value, ttl).Err()
+}
+
+// Invalidate bumps the version of table, the results stored under the previous one
+// aren't read any more and expire with their TTL.
+func (c *RedisCache) Invalidate(ctx context.Context, table string) error {
+	return c.client.Incr(ctx, c.versionKey(table)).Err()
+}
+
+// version returns the current version of the table of key, i.e. table + ":" + hash.
+func (c *RedisCache) version(ctx context.Context, key string) (string, error) {
+	i := strings.LastIndexByte(key, ':')
+	if i < 0 {
+		return "", nil
+	}
+
+	version, err := c.client.Get(ctx, c.versionKey(key[:i])).Result()
+	if err == redis.Nil {
+		return "0", nil
+	}
+	return version, err
+}
+
+// versioned returns the Redis key of key with version of its table.
+func (c *RedisCache) versioned(key, version string) string {
+	i := strings.LastIndexByte(key, ':')
+	if i < 0 {
+		return c.prefix + key
+	}
+	return c.prefix + key[:i] + ":" + version + key[i:]
+}
+
+func (c *RedisCache) versionKey(table string) string {
+	return c.prefix + table + ":version"
+}
@@ -0,0 +1,95 @@
+package gorm
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCacheKey(t *testing.T) {
+	var (
+		users []struct{ ID int }
+		user  struct{ ID int }
+	)
+	key := cacheKey("a", "users", "SELECT * FROM users WHERE id = ?", []interface{}{1}, &users)
+
+	testSuites := map[string]bool{
+		cacheKey("a", "users", "SELECT *\n\tFROM users  WHERE id = ?", []interface{}{1}, &users): true,
+		cacheKey("a", "users", "SELECT * FROM users WHERE id = ?", []interface{}{2}, &users):     false,
+		cacheKey("a", "users", "SELECT * FROM users WHERE id = ?", []interface{}{"1"}, &users):   false,
+		cacheKey("a", "users", "SELECT * FROM users WHERE id = ?", []interface{}{1}, &user):      false,
+		cacheKey("b", "users", "SELECT * FROM users WHERE id = ?", []interface{}{1}, &users):     false,
+	}
+
+	for other, expected := range testSuites {
+		if got := other == key; got != expected {
+			t.Errorf("cacheKey %v equals %v, expects %v, but got %v", other, key, expected, got)
+		}
+	}
+}
+
+func TestEncodeCached(t *testing.T) {
+	type user struct {
+		ID   int
+		Name string
+	}
+	users := []user{{1, "a"}, {2, "b"}}
+
+	data, err := encodeCached(&users, 2)
+	if err != nil {
+		t.Fatalf("encodeCached %v, expects no error, but got %v", users, err)
+	}
+	var got []user
+	rows, err := decodeCached(data, &got)
+	if err != nil || rows != 2 || len(got) != 2 || got[1] != users[1] {
+		t.Errorf("decodeCached, expects %v rows %v, but got %v rows %v, %v", users, 2, got, rows, err)
+	}
+
+	data, err = encodeCached(&user{ID: 1}, 1)
+	if err != nil {
+		t.Fatalf("encodeCached %v, expects no error, but got %v", user{ID: 1}, err)
+	}
+	stale := user{ID: 9, Name: "stale"}
+	if _, err = decodeCached(data, &stale); err != nil || stale != (user{ID: 1}) {
+		t.Errorf("decodeCached, expects %v, but got %v, %v", user{ID: 1}, stale, err)
+	}
+}
+
+func TestQueryCacheSharedPools(t *testing.T) {
+	type user struct {
+		ID   int
+		Name string
+	}
+	cache := NewQueryCache(WithCacheTTL(time.Minute))
+
+	names := []string{"a", "b"}
+	pools := make([]*gorm.DB, len(names))
+	for i, name := range names {
+		db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+		if err != nil {
+			t.Fatalf("gorm.Open %v, expects no error, but got %v", name, err)
+		}
+		if err = db.Use(cache); err != nil {
+			t.Fatalf("Use, expects no error, but got %v", err)
+		}
+		if err = db.AutoMigrate(&user{}); err != nil {
+			t.Fatalf("AutoMigrate, expects no error, but got %v", err)
+		}
+		if err = db.Create(&user{ID: 1, Name: name}).Error; err != nil {
+			t.Fatalf("Create, expects no error, but got %v", err)
+		}
+		pools[i] = db
+	}
+
+	// 两次查询, 第二次来自缓存
+	for round := 0; round < 2; round++ {
+		for i, db := range pools {
+			var got user
+			if err := db.First(&got, 1).Error; err != nil || got.Name != names[i] {
+				t.Errorf("First on pool %v, expects %v, but got %v, %v", names[i], names[i], got.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package gorm
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	_codeFilepathKey = attribute.Key("code.filepath")
+	_codeLinenoKey   = attribute.Key("code.lineno")
+	_codeFunctionKey = attribute.Key("code.function")
+
+	_maxCallerDepth = 32
+)
+
+var _pluginPkgPath = reflect.TypeOf(OpentracingPlugin{}).PkgPath()
+
+// callerAttributes returns the location of the first application frame issuing the query,
+// frames of gorm, its drivers and this plugin are skipped.
+func callerAttributes() []attribute.KeyValue {
+	frame, ok := callerFrame()
+	if !ok {
+		return nil
+	}
+
+	return []attribute.KeyValue{
+		_codeFilepathKey.String(frame.File),
+		_codeLinenoKey.Int(frame.Line),
+		_codeFunctionKey.String(frame.Function),
+	}
+}
+
+// callerLocation formats the application frame as file:line for logs.
+func callerLocation() string {
+	frame, ok := callerFrame()
+	if !ok {
+		return ""
+	}
+
+	return frame.File + ":" + strconv.Itoa(frame.Line)
+}
+
+func callerFrame() (runtime.Frame, bool) {
+	pcs := make([]uintptr, _maxCallerDepth)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !isInternalFrame(frame.Function) {
+			return frame, true
+		}
+
+		if !more {
+			return runtime.Frame{}, false
+		}
+	}
+}
+
+func isInternalFrame(function string) bool {
+	return strings.HasPrefix(function, "gorm.io/") ||
+		strings.HasPrefix(function, _pluginPkgPath+".") ||
+		strings.HasPrefix(function, _pluginPkgPath+"/")
+}
@@ -0,0 +1,116 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+var ErrUnknownRole = errors.New("gorm: unknown cluster role")
+
+// ClusterConfig describes a database cluster: a primary with its read replicas and
+// further roles with their own DSN, e.g. "analytics" for a reporting replica.
+type ClusterConfig struct {
+	Driver   Driver
+	Primary  string
+	Replicas []string
+	Roles    map[string]string
+}
+
+// Cluster gives access to the roles of a registered cluster.
+type Cluster struct {
+	name string
+	cfg  ClusterConfig
+	opts []ConnOption
+}
+
+// roleClusters are the registered clusters, guarded by rwl.
+var roleClusters = map[string]*Cluster{}
+
+// RegisterCluster registers cfg as name, opened with opts on first use. The primary and
+// its replicas are registered as name, reads being routed to replicas like WithReplicas,
+// each role is registered as "<name>/<role>" and its spans are tagged with db.role.
+func RegisterCluster(name string, cfg ClusterConfig, opts ...ConnOption) error {
+	if cfg.Driver == "" {
+		cfg.Driver = DriverMySQL
+	}
+	if !cfg.Driver.known() {
+		return ErrUnknownDriver
+	}
+
+	rwl.Lock()
+	defer rwl.Unlock()
+
+	if _, ok := roleClusters[name]; ok {
+		return ErrClusterRegistered
+	}
+	roleClusters[name] = &Cluster{name: name, cfg: cfg, opts: opts}
+	return nil
+}
+
+// GetCluster returns the cluster registered as name, its connections are opened by the
+// accessors on first use.
+func GetCluster(name string) (*Cluster, error) {
+	rwl.RLock()
+	defer rwl.RUnlock()
+
+	c, ok := roleClusters[name]
+	if !ok {
+		return nil, ErrUnknownCluster
+	}
+	return c, nil
+}
+
+// Primary returns the cluster connection with every statement sent to the primary.
+func (c *Cluster) Primary(ctx context.Context) (*gorm.DB, error) {
+	db, err := c.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Clauses(dbresolver.Write), nil
+}
+
+// Replica returns the cluster connection with every statement sent to a replica, or to
+// the primary if the cluster has none.
+func (c *Cluster) Replica(ctx context.Context) (*gorm.DB, error) {
+	db, err := c.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.Clauses(dbresolver.Read), nil
+}
+
+// Role returns the connection of role, unknown roles return ErrUnknownRole.
+func (c *Cluster) Role(ctx context.Context, role string) (*gorm.DB, error) {
+	dsn, ok := c.cfg.Roles[role]
+	if !ok {
+		return nil, ErrUnknownRole
+	}
+
+	name := c.name + "/" + role
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+
+	opts := make([]ConnOption, 0, len(c.opts)+1)
+	opts = append(opts, c.opts...)
+	opts = append(opts, WithPluginOptions(WithAttributes(_dbRoleKey.String(role))))
+	return open(ctx, name, &connection{driver: c.cfg.Driver, dsn: dsn, opts: opts})
+}
+
+// db returns the primary connection with its replicas.
+func (c *Cluster) db(ctx context.Context) (*gorm.DB, error) {
+	if db, ok := registered(c.name); ok {
+		return db, nil
+	}
+
+	opts := c.opts
+	if len(c.cfg.Replicas) > 0 {
+		opts = make([]ConnOption, 0, len(c.opts)+1)
+		opts = append(opts, WithReplicas(c.cfg.Replicas...))
+		opts = append(opts, c.opts...)
+	}
+	return open(ctx, c.name, &connection{driver: c.cfg.Driver, dsn: c.cfg.Primary, opts: opts})
+}
@@ -0,0 +1,197 @@
+package gorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnknownConfigFormat = errors.New("gorm: config file must be .json, .yaml or .yml")
+
+// FileConfig declares named connections, e.g. in YAML:
+//
+//	connections:
+//	  users:
+//	    driver: mysql
+//	    host: 10.0.0.1
+//	    port: 3306
+//	    user: app
+//	    password: secret
+//	    dbname: users
+//	    params: {parseTime: "true"}
+//	    max_open_conns: 50
+//	    conn_max_lifetime: 5m
+//	    plugin: {sql_parameters: false, slow_query_threshold: 200ms}
+//	  events:
+//	    driver: clickhouse
+//	    dsn: clickhouse://127.0.0.1:9000/events
+type FileConfig struct {
+	Connections map[string]ConnectionConfig `json:"connections" yaml:"connections"`
+}
+
+// ConnectionConfig declares a connection, DSN takes precedence over the DSN parts.
+type ConnectionConfig struct {
+	Driver   Driver            `json:"driver" yaml:"driver"`
+	DSN      string            `json:"dsn" yaml:"dsn"`
+	Host     string            `json:"host" yaml:"host"`
+	Port     int               `json:"port" yaml:"port"`
+	User     string            `json:"user" yaml:"user"`
+	Password string            `json:"password" yaml:"password"`
+	DBName   string            `json:"dbname" yaml:"dbname"`
+	Params   map[string]string `json:"params" yaml:"params"`
+
+	MaxOpenConns    int      `json:"max_open_conns" yaml:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns" yaml:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime" yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time" yaml:"conn_max_idle_time"`
+	Lazy            bool     `json:"lazy" yaml:"lazy"`
+
+	Plugin PluginConfig `json:"plugin" yaml:"plugin"`
+}
+
+// PluginConfig declares the plugin options of a connection.
+type PluginConfig struct {
+	LogResult          bool     `json:"log_result" yaml:"log_result"`
+	SqlParameters      *bool    `json:"sql_parameters" yaml:"sql_parameters"`
+	SqlObfuscation     bool     `json:"sql_obfuscation" yaml:"sql_obfuscation"`
+	SlowQueryThreshold Duration `json:"slow_query_threshold" yaml:"slow_query_threshold"`
+	IgnoredTables      []string `json:"ignored_tables" yaml:"ignored_tables"`
+}
+
+// Duration is a time.Duration written as "500ms", "5m", ... in config files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig reads connections from a JSON or YAML file, by extension, and registers
+// each of them like Get. Connections failing to open are reported together.
+func LoadConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var cfg FileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &cfg)
+	default:
+		err = ErrUnknownConfigFormat
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for name, c := range cfg.Connections {
+		if err := c.register(context.Background(), name); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func (c ConnectionConfig) register(ctx context.Context, name string) error {
+	driver, dsn, err := c.dsn()
+	if err != nil {
+		return err
+	}
+
+	_, err = GetWithDriver(ctx, name, driver, dsn, c.options()...)
+	return err
+}
+
+// dsn returns the driver, MySQL by default, and the DSN built from the parts if not set.
+func (c ConnectionConfig) dsn() (Driver, string, error) {
+	parts := DSNConfig{
+		Driver:   c.Driver,
+		Host:     c.Host,
+		Port:     c.Port,
+		User:     c.User,
+		Password: c.Password,
+		DBName:   c.DBName,
+		Params:   c.Params,
+	}
+	if c.DSN != "" {
+		return parts.driver(), c.DSN, nil
+	}
+
+	if err := parts.Validate(); err != nil {
+		return "", "", err
+	}
+	return parts.driver(), parts.String(), nil
+}
+
+func (c ConnectionConfig) options() []ConnOption {
+	var opts []ConnOption
+	if c.MaxOpenConns > 0 {
+		opts = append(opts, WithMaxOpenConns(c.MaxOpenConns))
+	}
+	if c.MaxIdleConns > 0 {
+		opts = append(opts, WithMaxIdleConns(c.MaxIdleConns))
+	}
+	if c.ConnMaxLifetime > 0 {
+		opts = append(opts, WithConnMaxLifetime(time.Duration(c.ConnMaxLifetime)))
+	}
+	if c.ConnMaxIdleTime > 0 {
+		opts = append(opts, WithConnMaxIdleTime(time.Duration(c.ConnMaxIdleTime)))
+	}
+	if c.Lazy {
+		opts = append(opts, WithLazy())
+	}
+
+	return append(opts, WithPluginOptions(c.Plugin.options()...))
+}
+
+func (p PluginConfig) options() []ApplyOption {
+	opts := []ApplyOption{WithLogResult(p.LogResult)}
+	if p.SqlParameters != nil {
+		opts = append(opts, WithSqlParameters(*p.SqlParameters))
+	}
+	if p.SqlObfuscation {
+		opts = append(opts, WithSqlObfuscation(true))
+	}
+	if p.SlowQueryThreshold > 0 {
+		opts = append(opts, WithSlowQueryThreshold(time.Duration(p.SlowQueryThreshold)))
+	}
+	if len(p.IgnoredTables) > 0 {
+		opts = append(opts, WithIgnoredTables(p.IgnoredTables...))
+	}
+
+	return opts
+}
@@ -0,0 +1,140 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v4/stdlib"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// ConnectHook runs on every new physical connection before the pool hands it out, e.g.
+// to set session variables. A failing hook discards the connection and fails the query
+// that dialed it.
+type ConnectHook func(ctx context.Context, conn driver.Conn) error
+
+var ErrConnectHookUnsupported = errors.New("gorm: connect hooks are only supported by the mysql, postgres and sqlite drivers")
+
+// WithOnConnect runs hooks in order on every new connection of the pool.
+func WithOnConnect(hooks ...ConnectHook) ConnOption {
+	return func(o *connOptions) {
+		o.connectHooks = append(o.connectHooks, hooks...)
+	}
+}
+
+// WithSessionSQL executes statements on every new connection of the pool, e.g.
+// "SET time_zone = '+00:00'", "SET SESSION sql_mode = 'STRICT_ALL_TABLES'" or
+// "SET search_path TO app" for Postgres.
+func WithSessionSQL(statements ...string) ConnOption {
+	return WithOnConnect(func(ctx context.Context, conn driver.Conn) error {
+		for _, query := range statements {
+			if err := execConn(ctx, conn, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// execConn executes query on a driver connection outside of database/sql.
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if sc, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = sc.ExecContext(ctx, nil)
+		return err
+	}
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+// sqlDriver returns the database/sql driver the dialector of d opens DSNs with.
+func (d Driver) sqlDriver() driver.Driver {
+	switch d {
+	case DriverMySQL:
+		return &gomysql.MySQLDriver{}
+	case DriverPostgres:
+		return stdlib.GetDefaultDriver()
+	case DriverSQLite:
+		return &sqlite3.SQLiteDriver{}
+	}
+	return nil
+}
+
+// connectorDialector opens a pool dialing through a connector, with the DSN of provider
+// if set or else failing over along dsns, running hooks on every new connection.
+func (d Driver) connectorDialector(name string, dsns []string, provider DSNProvider, hooks []ConnectHook, lazy bool) (gorm.Dialector, error) {
+	drv := d.sqlDriver()
+	if drv == nil {
+		switch {
+		case provider != nil:
+			return nil, ErrProviderUnsupported
+		case len(dsns) > 1:
+			return nil, ErrFailoverUnsupported
+		}
+		return nil, ErrConnectHookUnsupported
+	}
+
+	var connector driver.Connector
+	switch {
+	case provider != nil:
+		connector = &providerConnector{driver: drv, provider: provider}
+	case len(dsns) > 1:
+		connector = &failoverConnector{driver: drv, name: name, dsns: dsns, connectors: make([]driver.Connector, len(dsns))}
+	default:
+		connector = &providerConnector{driver: drv, provider: func(context.Context) (string, error) { return dsns[0], nil }}
+	}
+	if len(hooks) > 0 {
+		connector = &hookConnector{Connector: connector, hooks: hooks}
+	}
+
+	conn := sql.OpenDB(connector)
+	switch d {
+	case DriverMySQL:
+		return mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: lazy}), nil
+	case DriverPostgres:
+		return postgres.New(postgres.Config{Conn: conn}), nil
+	default:
+		return &sqlite.Dialector{Conn: conn}, nil
+	}
+}
+
+// hookConnector runs hooks on the connections of the wrapped connector.
+type hookConnector struct {
+	driver.Connector
+	hooks []ConnectHook
+}
+
+func (c *hookConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range c.hooks {
+		if err = hook(ctx, conn); err != nil {
+			// 会话未初始化完整的连接不能放回连接池
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,132 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	ddtrace "gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	ddext "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	"gorm.io/gorm"
+)
+
+const (
+	_ddOperationName = "gorm.db"
+	_ddOperationTag  = "gorm.operation"
+)
+
+// NewDatadog creates the plugin reporting spans to dd-trace-go directly, following Datadog
+// conventions: operation "gorm.db", span type "sql", the statement as resource and the plugin
+// operation (create, query, ...) as the "gorm.operation" tag. Span events become tags.
+// Span contexts are not exposed to OpenTelemetry: WithRequireParentSpan looks for a Datadog
+// parent span instead, and WithSqlCommenter fails the registration with ErrSqlCommenterUnsupported.
+func NewDatadog(service string, opts ...ApplyOption) gorm.Plugin {
+	return New(append([]ApplyOption{WithTracer(&ddTracerProvider{service: service})}, opts...)...)
+}
+
+type ddTracerProvider struct {
+	service string
+}
+
+func (p *ddTracerProvider) hasParent(ctx context.Context) bool {
+	_, ok := tracer.SpanFromContext(ctx)
+	return ok
+}
+
+func (p *ddTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p
+}
+
+func (p *ddTracerProvider) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+
+	startOpts := []ddtrace.StartSpanOption{
+		tracer.SpanType(ddext.SpanTypeSQL),
+		tracer.ResourceName(spanName),
+		tracer.Tag(_ddOperationTag, spanName),
+	}
+	if p.service != "" {
+		startOpts = append(startOpts, tracer.ServiceName(p.service))
+	}
+	if ts := cfg.Timestamp(); !ts.IsZero() {
+		startOpts = append(startOpts, tracer.StartTime(ts))
+	}
+
+	sp, ctx := tracer.StartSpanFromContext(ctx, _ddOperationName, startOpts...)
+	span := &ddSpan{span: sp, provider: p}
+	span.SetAttributes(cfg.Attributes()...)
+
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type ddSpan struct {
+	span     ddtrace.Span
+	provider *ddTracerProvider
+}
+
+func (s *ddSpan) End(options ...trace.SpanEndOption) {
+	cfg := trace.NewSpanEndConfig(options...)
+	s.span.Finish(tracer.FinishTime(cfg.Timestamp()))
+}
+
+func (s *ddSpan) AddEvent(name string, options ...trace.EventOption) {
+	cfg := trace.NewEventConfig(options...)
+	s.span.SetTag("event."+name, true)
+	for _, attr := range cfg.Attributes() {
+		s.span.SetTag(fmt.Sprintf("event.%s.%s", name, attr.Key), attr.Value.AsInterface())
+	}
+}
+
+func (s *ddSpan) IsRecording() bool {
+	return true
+}
+
+func (s *ddSpan) RecordError(err error, options ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+
+	s.span.SetTag(ddext.Error, err)
+}
+
+func (s *ddSpan) SpanContext() trace.SpanContext {
+	return trace.SpanContext{}
+}
+
+func (s *ddSpan) SetStatus(code codes.Code, description string) {
+	if code == codes.Error {
+		s.span.SetTag(ddext.Error, true)
+	}
+}
+
+func (s *ddSpan) SetName(name string) {
+	s.span.SetTag(_ddOperationTag, name)
+}
+
+func (s *ddSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		if isStatementKey(attr.Key) {
+			s.span.SetTag(ddext.ResourceName, attr.Value.AsString())
+			continue
+		}
+
+		s.span.SetTag(string(attr.Key), attr.Value.AsInterface())
+	}
+}
+
+func (s *ddSpan) TracerProvider() trace.TracerProvider {
+	return s.provider
+}
+
+func isStatementKey(key attribute.Key) bool {
+	for _, keys := range _semconvKeys {
+		if keys.dbStatement == key {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,69 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/asyncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// RegisterDBStatsMetrics exports sql.DBStats of every connection registered by Get as
+// gauges labeled by db.connection.name. Stats are read when the MeterProvider collects,
+// call it once per MeterProvider.
+func RegisterDBStatsMetrics(mp metric.MeterProvider) error {
+	meter := mp.Meter(_defaultTracerName, metric.WithInstrumentationVersion(_instrumentationVersion))
+
+	var (
+		gauges = map[string]asyncint64.Gauge{}
+		insts  []instrument.Asynchronous
+	)
+	for _, def := range []struct {
+		name, desc string
+		unit       unit.Unit
+	}{
+		{"db.client.connections.open", "Number of established connections.", unit.Dimensionless},
+		{"db.client.connections.in_use", "Number of connections currently in use.", unit.Dimensionless},
+		{"db.client.connections.idle", "Number of idle connections.", unit.Dimensionless},
+		{"db.client.connections.max", "Maximum number of open connections allowed.", unit.Dimensionless},
+		{"db.client.connections.wait_count", "Total number of connections waited for.", unit.Dimensionless},
+		{"db.client.connections.wait_duration", "Total time blocked waiting for a new connection.", unit.Milliseconds},
+	} {
+		g, err := meter.AsyncInt64().Gauge(def.name, instrument.WithUnit(def.unit), instrument.WithDescription(def.desc))
+		if err != nil {
+			return err
+		}
+		gauges[def.name] = g
+		insts = append(insts, g)
+	}
+
+	return meter.RegisterCallback(insts, func(ctx context.Context) {
+		for name, stats := range registeredDBStats() {
+			attr := []attribute.KeyValue{_connectionNameKey.String(name)}
+			gauges["db.client.connections.open"].Observe(ctx, int64(stats.OpenConnections), attr...)
+			gauges["db.client.connections.in_use"].Observe(ctx, int64(stats.InUse), attr...)
+			gauges["db.client.connections.idle"].Observe(ctx, int64(stats.Idle), attr...)
+			gauges["db.client.connections.max"].Observe(ctx, int64(stats.MaxOpenConnections), attr...)
+			gauges["db.client.connections.wait_count"].Observe(ctx, stats.WaitCount, attr...)
+			gauges["db.client.connections.wait_duration"].Observe(ctx, stats.WaitDuration.Milliseconds(), attr...)
+		}
+	})
+}
+
+// registeredDBStats snapshots pool stats of registered connections by name.
+func registeredDBStats() map[string]sql.DBStats {
+	rwl.RLock()
+	defer rwl.RUnlock()
+
+	stats := make(map[string]sql.DBStats, len(dbs))
+	for name, c := range dbs {
+		if sqlDB, err := c.db.DB(); err == nil {
+			stats[name] = sqlDB.Stats()
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,111 @@
+package gorm
+
+import (
+	"errors"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	gormcallbacks "gorm.io/gorm/callbacks"
+)
+
+const (
+	_dedupPluginName = "otel:dedup"
+	_coalescedKey    = attribute.Key("db.query.coalesced")
+
+	// _coalescedInstance 标记结果来自其他并发查询的语句
+	_coalescedInstance = "query_coalesced"
+)
+
+// QueryDedup is a gorm plugin coalescing identical concurrent queries, same connection,
+// SQL and parameters, into one database round trip whose result is copied to every
+// caller, e.g. when a cache entry expires under load. Queries in transactions or locking
+// rows run on their own. Callers served by another query have db.query.coalesced on
+// their span. A failing query fails the callers coalesced into it, unless it failed
+// because the context of its caller is done, they query on their own then. Combined
+// with QueryCache it serves the misses of the cache.
+type QueryDedup struct {
+	group singleflight.Group
+}
+
+// NewQueryDedup creates the dedup plugin, register it with db.Use.
+func NewQueryDedup() *QueryDedup {
+	return &QueryDedup{}
+}
+
+func (d *QueryDedup) Name() string {
+	return _dedupPluginName
+}
+
+func (d *QueryDedup) Initialize(db *gorm.DB) error {
+	if err := registerCacheScope(db); err != nil {
+		return err
+	}
+	return db.Callback().Query().Replace("gorm:query", runQuery)
+}
+
+// errLeaderDone is shared with the coalesced callers when the context of the caller
+// running the query is done.
+var errLeaderDone = errors.New("gorm: coalesced query context done")
+
+type dedupResult struct {
+	data []byte
+	rows int64
+}
+
+func (d *QueryDedup) queryStage(db *gorm.DB, next func(db *gorm.DB)) {
+	if db.Error != nil || db.DryRun || !shareable(db.Statement) {
+		next(db)
+		return
+	}
+
+	gormcallbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+	stmt, ctx := db.Statement, db.Statement.Context
+	key := cacheKey(statementScope(db), stmt.Table, statementSQL(db), stmt.Vars, stmt.Dest) + ":" + strconv.FormatBool(stmt.RaiseErrorOnNotFound)
+
+	leader := false
+	v, err, shared := d.group.Do(key, func() (interface{}, error) {
+		leader = true
+		next(db)
+		if db.Error != nil {
+			if ctx.Err() != nil {
+				return nil, errLeaderDone
+			}
+			return nil, db.Error
+		}
+		data, err := encodeCached(stmt.Dest, db.RowsAffected)
+		if err != nil {
+			// 无法编码的结果没有data, 其他调用方单独查询
+			data = nil
+		}
+		return dedupResult{data: data, rows: db.RowsAffected}, nil
+	})
+	if leader || !shared {
+		return
+	}
+
+	if err == errLeaderDone {
+		next(db)
+		return
+	}
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	res := v.(dedupResult)
+	if res.data == nil {
+		next(db)
+		return
+	}
+	if _, err = decodeCached(res.data, stmt.Dest); err != nil {
+		// 结果无法复制时单独查询
+		next(db)
+		return
+	}
+	db.RowsAffected = res.rows
+	db.InstanceSet(_coalescedInstance, true)
+}
@@ -0,0 +1,109 @@
+package gorm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// blockingStage holds queries inside the flight of QueryDedup until release is closed, it
+// takes the place of the retry plugin.
+type blockingStage struct {
+	release chan struct{}
+}
+
+func (s blockingStage) Name() string {
+	return _retryPluginName
+}
+
+func (s blockingStage) Initialize(*gorm.DB) error {
+	return nil
+}
+
+func (s blockingStage) queryStage(db *gorm.DB, next func(db *gorm.DB)) {
+	<-s.release
+	next(db)
+}
+
+type dedupUser struct {
+	ID   int
+	Name string
+}
+
+func openDedupDB(t *testing.T, name string, dedup *QueryDedup, stage blockingStage) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:dedup_"+name+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open %v, expects no error, but got %v", name, err)
+	}
+	if err = db.AutoMigrate(&dedupUser{}); err != nil {
+		t.Fatalf("AutoMigrate, expects no error, but got %v", err)
+	}
+	if err = db.Create(&dedupUser{ID: 1, Name: name}).Error; err != nil {
+		t.Fatalf("Create, expects no error, but got %v", err)
+	}
+	if err = db.Use(dedup); err != nil {
+		t.Fatalf("Use, expects no error, but got %v", err)
+	}
+	db.Config.Plugins[_retryPluginName] = stage
+	return db
+}
+
+func TestQueryDedupSharedPools(t *testing.T) {
+	dedup, stage := NewQueryDedup(), blockingStage{release: make(chan struct{})}
+	names := []string{"a", "b"}
+
+	var wg sync.WaitGroup
+	got := make([]dedupUser, len(names))
+	for i, name := range names {
+		db := openDedupDB(t, name, dedup, stage)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db.First(&got[i], 1)
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(stage.release)
+	wg.Wait()
+
+	for i, name := range names {
+		if got[i].Name != name {
+			t.Errorf("First on pool %v, expects %v, but got %v", name, name, got[i].Name)
+		}
+	}
+}
+
+func TestQueryDedupLeaderDone(t *testing.T) {
+	stage := blockingStage{release: make(chan struct{})}
+	db := openDedupDB(t, "leader", NewQueryDedup(), stage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var leaderErr error
+	var follower dedupUser
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var user dedupUser
+		leaderErr = db.WithContext(ctx).First(&user, 1).Error
+	}()
+	time.Sleep(50 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		db.First(&follower, 1)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 主调用方的ctx结束后, 跟随者单独查询
+	cancel()
+	close(stage.release)
+	wg.Wait()
+
+	if leaderErr == nil || follower.Name != "leader" {
+		t.Errorf("coalesced query of a cancelled caller, expects its error and %v for the follower, but got %v and %v", "leader", leaderErr, follower.Name)
+	}
+}
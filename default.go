@@ -0,0 +1,34 @@
+package gorm
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// defaultName is the connection Default returns, guarded by rwl.
+var defaultName string
+
+// SetDefault makes the connection registered as name the one Default returns, so library
+// code can reach the application database without being handed its name or DSN. name may
+// be registered before or after the call.
+func SetDefault(name string) {
+	rwl.Lock()
+	defer rwl.Unlock()
+
+	defaultName = name
+}
+
+// Default returns the default connection bound to ctx, or nil if SetDefault wasn't called
+// or the connection isn't registered (yet, or any more after Close).
+func Default(ctx context.Context) *gorm.DB {
+	rwl.RLock()
+	name := defaultName
+	c, ok := dbs[name]
+	rwl.RUnlock()
+	if !ok || name == "" {
+		return nil
+	}
+
+	return c.db.WithContext(ctx)
+}
@@ -0,0 +1,96 @@
+package gorm
+
+import (
+	"database/sql"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+const _maskedPassword = "xxxxx"
+
+var _pgPasswordRe = regexp.MustCompile(`(^|\s)password(\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// ConnectionInfo describes a registered connection for admin and debug endpoints.
+type ConnectionInfo struct {
+	Name     string
+	Driver   string
+	DSN      string
+	OpenedAt time.Time
+	Stats    sql.DBStats
+}
+
+// Names returns the sorted names of registered connections.
+func Names() []string {
+	names := registeredNames()
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the driver, DSN with the password masked, open time and pool stats of
+// a registered connection. Unknown names return ErrNotFound.
+func Describe(name string) (ConnectionInfo, error) {
+	rwl.RLock()
+	c, ok := dbs[name]
+	rwl.RUnlock()
+	if !ok {
+		return ConnectionInfo{}, ErrNotFound
+	}
+
+	info := ConnectionInfo{
+		Name:     name,
+		Driver:   c.db.Dialector.Name(),
+		DSN:      sanitizeDSN(c.driver, c.dsn),
+		OpenedAt: c.openedAt,
+	}
+	if sqlDB, err := c.db.DB(); err == nil {
+		info.Stats = sqlDB.Stats()
+	}
+
+	return info, nil
+}
+
+// sanitizeDSN masks the password of dsn, DSNs that can't be parsed are dropped entirely.
+func sanitizeDSN(driver Driver, dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+
+	switch driver {
+	case DriverMySQL:
+		cfg, err := gomysql.ParseDSN(dsn)
+		if err != nil {
+			return ""
+		}
+		if cfg.Passwd != "" {
+			cfg.Passwd = _maskedPassword
+		}
+		return cfg.FormatDSN()
+	case DriverPostgres, DriverClickHouse:
+		if !strings.Contains(dsn, "://") {
+			// libpq的key=value格式
+			return _pgPasswordRe.ReplaceAllString(dsn, "${1}password${2}"+_maskedPassword)
+		}
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return ""
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), _maskedPassword)
+		}
+		q := u.Query()
+		if q.Get("password") != "" {
+			q.Set("password", _maskedPassword)
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	case DriverSQLite:
+		return dsn
+	}
+
+	return ""
+}
@@ -0,0 +1,68 @@
+package gorm
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/driver/clickhouse"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Driver selects the dialector a DSN is opened with by GetWithDriver.
+type Driver string
+
+const (
+	DriverMySQL    Driver = "mysql"
+	DriverPostgres Driver = "postgres"
+	// DriverSQLite takes a file path or ":memory:", meant for local development and tests.
+	DriverSQLite     Driver = "sqlite"
+	DriverClickHouse Driver = "clickhouse"
+)
+
+var ErrUnknownDriver = errors.New("gorm: unknown driver")
+
+func (d Driver) known() bool {
+	switch d {
+	case DriverMySQL, DriverPostgres, DriverSQLite, DriverClickHouse:
+		return true
+	}
+	return false
+}
+
+// dialector opens dsn, lazy skips the server version query on initialization.
+func (d Driver) dialector(dsn string, lazy bool) (gorm.Dialector, error) {
+	switch d {
+	case DriverMySQL:
+		return mysql.New(mysql.Config{DSN: dsn, SkipInitializeWithVersion: lazy}), nil
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverSQLite:
+		return sqlite.Open(dsn), nil
+	case DriverClickHouse:
+		return clickhouse.New(clickhouse.Config{DSN: dsn, SkipInitializeWithVersion: lazy}), nil
+	}
+
+	return nil, ErrUnknownDriver
+}
+
+// configure adjusts a freshly opened pool to the driver.
+func (d Driver) configure(db *gorm.DB, dsn string) error {
+	if d != DriverSQLite || !isSQLiteMemory(dsn) {
+		return nil
+	}
+
+	// 内存库每个连接各自独立, 限制为单连接保证所有语句看到同一个库
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	return nil
+}
+
+func isSQLiteMemory(dsn string) bool {
+	return strings.HasPrefix(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")
+}
@@ -0,0 +1,169 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDSNHostRequired      = errors.New("gorm: dsn host is required")
+	ErrDSNDBNameRequired    = errors.New("gorm: dsn dbname is required")
+	ErrDSNInvalidPort       = errors.New("gorm: dsn port is out of range")
+	ErrDSNSocketPath        = errors.New("gorm: dsn socket must be an absolute path")
+	ErrDSNSocketUnsupported = errors.New("gorm: dsn socket is only supported by the mysql and postgres drivers")
+	ErrCloudSQLInstance     = errors.New("gorm: cloud sql instance must be project:region:instance")
+)
+
+// _cloudSQLDir is where the Cloud SQL Auth Proxy and Cloud Run create instance sockets.
+const _cloudSQLDir = "/cloudsql"
+
+// DSNConfig builds a DSN from its parts, escaping user, password and params as the
+// driver expects, MySQL by default. For SQLite DBName is the file path or ":memory:".
+type DSNConfig struct {
+	Driver Driver
+	Host   string
+	Port   int
+	// Socket connects through a unix socket instead of Host and Port, it is the socket
+	// path for MySQL and the directory of the socket for Postgres, see CloudSQLSocket.
+	Socket   string
+	User     string
+	Password string
+	DBName   string
+	Params   map[string]string
+}
+
+func (c DSNConfig) driver() Driver {
+	if c.Driver == "" {
+		return DriverMySQL
+	}
+	return c.Driver
+}
+
+// Validate reports missing or invalid parts.
+func (c DSNConfig) Validate() error {
+	if !c.driver().known() {
+		return ErrUnknownDriver
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return ErrDSNInvalidPort
+	}
+	if c.driver() == DriverSQLite {
+		if c.DBName == "" {
+			return ErrDSNDBNameRequired
+		}
+		return nil
+	}
+	if c.Socket != "" {
+		if c.driver() != DriverMySQL && c.driver() != DriverPostgres {
+			return ErrDSNSocketUnsupported
+		}
+		if !path.IsAbs(c.Socket) {
+			return ErrDSNSocketPath
+		}
+		return nil
+	}
+	if c.Host == "" {
+		return ErrDSNHostRequired
+	}
+
+	return nil
+}
+
+// String formats the DSN, it is empty for unknown drivers.
+func (c DSNConfig) String() string {
+	switch driver := c.driver(); driver {
+	case DriverMySQL:
+		cfg := gomysql.NewConfig()
+		cfg.User, cfg.Passwd = c.User, c.Password
+		cfg.Net, cfg.Addr = "tcp", c.addr()
+		if c.Socket != "" {
+			cfg.Net, cfg.Addr = "unix", c.Socket
+		}
+		cfg.DBName = c.DBName
+		if len(c.Params) > 0 {
+			cfg.Params = c.Params
+		}
+		return cfg.FormatDSN()
+	case DriverPostgres, DriverClickHouse:
+		params := c.Params
+		if c.Socket != "" {
+			// libpq的写法, 主机为空, 套接字目录放在host参数里
+			params = make(map[string]string, len(c.Params)+1)
+			for k, v := range c.Params {
+				params[k] = v
+			}
+			params["host"] = c.Socket
+		}
+		u := url.URL{Scheme: string(driver), Host: c.addr(), Path: "/" + c.DBName, RawQuery: encodeParams(params)}
+		if c.Password != "" {
+			u.User = url.UserPassword(c.User, c.Password)
+		} else if c.User != "" {
+			u.User = url.User(c.User)
+		}
+		return u.String()
+	case DriverSQLite:
+		if len(c.Params) == 0 {
+			return c.DBName
+		}
+		return c.DBName + "?" + encodeParams(c.Params)
+	}
+
+	return ""
+}
+
+func (c DSNConfig) addr() string {
+	if c.Socket != "" {
+		return ""
+	}
+	if c.Port == 0 {
+		return c.Host
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// GetWithDSNConfig is GetWithDriver with a validated DSNConfig instead of a raw DSN.
+func GetWithDSNConfig(ctx context.Context, name string, cfg DSNConfig, opts ...ConnOption) (*gorm.DB, error) {
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, &OpenError{Name: name, Kind: ErrBadDSN, Err: err}
+	}
+
+	return GetWithDriver(ctx, name, cfg.driver(), cfg.String(), opts...)
+}
+
+// CloudSQLSocket returns the socket the Cloud SQL Auth Proxy or Cloud Run serve instance
+// on, e.g. "/cloudsql/my-project:europe-west1:users" for DSNConfig.Socket. instance is
+// the connection name of the instance, "project:region:instance" or
+// "domain:project:region:instance" for domain scoped projects.
+func CloudSQLSocket(instance string) (string, error) {
+	parts := strings.Split(instance, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return "", ErrCloudSQLInstance
+	}
+	for _, part := range parts {
+		if part == "" || strings.ContainsAny(part, "/ ") {
+			return "", ErrCloudSQLInstance
+		}
+	}
+
+	return path.Join(_cloudSQLDir, instance), nil
+}
+
+// encodeParams encodes params sorted by key, so the DSN is stable.
+func encodeParams(params map[string]string) string {
+	values := make(url.Values, len(params))
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
@@ -2,45 +2,76 @@ package gorm
 
 import (
 	"context"
+	"errors"
 	"strings"
-	"sync"
+	"unicode/utf8"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
 	"go.opentelemetry.io/otel/trace"
-	"golang.org/x/sync/singleflight"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-func (op OpentracingPlugin) beforeCreate(db *gorm.DB) {
+func (op *OpentracingPlugin) beforeCreate(db *gorm.DB) {
 	op.injectBefore(db, op.opt.createOpName)
 }
 
-func (op OpentracingPlugin) beforeUpdate(db *gorm.DB) {
+func (op *OpentracingPlugin) beforeUpdate(db *gorm.DB) {
 	op.injectBefore(db, op.opt.updateOpName)
 }
 
-func (op OpentracingPlugin) beforeQuery(db *gorm.DB) {
+func (op *OpentracingPlugin) beforeQuery(db *gorm.DB) {
 	op.injectBefore(db, op.opt.queryOpName)
 }
 
-func (op OpentracingPlugin) beforeDelete(db *gorm.DB) {
+func (op *OpentracingPlugin) beforeDelete(db *gorm.DB) {
 	op.injectBefore(db, op.opt.deleteOpName)
 }
 
-func (op OpentracingPlugin) beforeRow(db *gorm.DB) {
+func (op *OpentracingPlugin) beforeRow(db *gorm.DB) {
 	op.injectBefore(db, op.opt.rowOpName)
 }
 
-func (op OpentracingPlugin) beforeRaw(db *gorm.DB) {
+func (op *OpentracingPlugin) beforeRaw(db *gorm.DB) {
 	op.injectBefore(db, op.opt.rawOpName)
 }
 
-func (op OpentracingPlugin) after(db *gorm.DB) {
+func (op *OpentracingPlugin) after(db *gorm.DB) {
 	op.extractAfter(db)
 }
 
+// beforeStatement and afterStatement time the statement itself, metrics and slow query
+// checks use it, while the span around them also covers nested preloads and associations.
+func (op *OpentracingPlugin) beforeStatement(db *gorm.DB) {
+	db.InstanceSet("statement_start", time.Now())
+	if v, _ := db.InstanceGet("pool_stats"); v != nil {
+		if stats, ok := poolStats(db); ok {
+			db.InstanceSet("pool_stats", stats)
+		}
+	}
+}
+
+func (op *OpentracingPlugin) afterStatement(db *gorm.DB) {
+	if start, ok := instanceTime(db, "statement_start"); ok {
+		db.InstanceSet("statement_cost", time.Since(start))
+	}
+	if v, _ := db.InstanceGet("pool_stats"); v != nil {
+		if stats, ok := poolStats(db); ok {
+			db.InstanceSet("pool_stats_after", stats)
+		}
+	}
+}
+
+func instanceTime(db *gorm.DB, key string) (time.Time, bool) {
+	v, _ := db.InstanceGet(key)
+	t, ok := v.(time.Time)
+	return t, ok
+}
+
 
 type myError struct {
 	errs []string
@@ -70,6 +101,12 @@ func (e *myError) Error() string {
 const (
 	_prefix      = "gorm.otel"
 	_errorTagKey = "error"
+
+	_truncatedMarker = "..."
+	_slowQueryEvent  = "slow_query"
+
+	_defaultTracerName      = "MySQL-Operation"
+	_instrumentationVersion = "v0.1.0"
 )
 
 var (
@@ -77,6 +114,13 @@ var (
 	_resultLogKey       = keyWithPrefix("result")
 	_sqlLogKey          = keyWithPrefix("sql")
 	_rowsAffectedLogKey = keyWithPrefix("rowsAffected")
+	_txDurationKey      = keyWithPrefix("transaction.durationMs")
+	_truncatedKey       = keyWithPrefix("truncated")
+	_durationKey        = keyWithPrefix("durationUs")
+
+	_slowQueryKey          = attribute.Key("slow_query")
+	_slowQueryThresholdKey = keyWithPrefix("slowQuery.thresholdMs")
+	_connectionNameKey     = attribute.Key("db.connection.name")
 
 	spanKey = "otel:span"
 )
@@ -85,7 +129,7 @@ func keyWithPrefix(key string) string {
 	return _prefix + "." + key
 }
 
-func (op OpentracingPlugin) injectBefore(db *gorm.DB, name operationName) {
+func (op *OpentracingPlugin) injectBefore(db *gorm.DB, name OperationName) {
 	if db == nil || db.Statement == nil {
 		return
 	}
@@ -95,18 +139,200 @@ func (op OpentracingPlugin) injectBefore(db *gorm.DB, name operationName) {
 		return
 	}
 
-	tr := otel.Tracer("MySQL-Operation")
-	ctx, span := tr.Start(ctx, string(name))
-
-	span.SetAttributes(util.DBSystemValue)
-	span.SetAttributes(util.DBNameKey.String(db.Name()))
-
 	now := time.Now()
 	db.InstanceSet("start_time", now)
+	db.InstanceSet("statement_start", now)
+	db.InstanceSet("operation", name)
+	db.InstanceSet("inflight", op.inflight.inc(name))
+	// Statement可能被复用, 清掉上一次的状态
+	db.InstanceSet("traced", false)
+	db.InstanceSet("span", nil)
+	db.InstanceSet("parent_ctx", nil)
+	db.InstanceSet("statement_cost", nil)
+	db.InstanceSet("pool_stats", nil)
+	db.InstanceSet("pool_stats_after", nil)
+	db.InstanceSet(_sqlCommentInstance, "")
+
+	if !op.tracing(ctx) || op.ignored(db.Statement) || !op.sampled(name, db.Statement) {
+		return
+	}
+	db.InstanceSet("traced", true)
+
+	// 设置了最小耗时, 到after里再决定是否建span
+	if op.opt.minSpanDuration > 0 {
+		return
+	}
+
+	parent := ctx
+	var opts []trace.SpanStartOption
+	var batchAttrs []attribute.KeyValue
+	if name == op.opt.createOpName {
+		opts, batchAttrs = batchSpan(parent, db.Statement)
+	}
+
+	ctx, span := op.startSpan(ctx, db, name, opts...)
+	if rel, ok := nestedRelationOf(parent, db.Statement); ok {
+		span.SetAttributes(rel)
+	}
+	if len(batchAttrs) > 0 {
+		span.SetAttributes(batchAttrs...)
+	}
+
+	if op.opt.sqlCommenter && !preparedStmt(db.Statement.ConnPool) {
+		comment := sqlComment(ctx)
+		injectSQLComment(db.Statement, comment)
+		db.InstanceSet(_sqlCommentInstance, comment)
+	}
+
+	// preload/关联写入复用Statement.Context, 替换后它们的span会挂在当前span下, after里还原
+	db.Statement.Context = withNestedRelations(ctx, db.Statement, name == op.opt.queryOpName)
+	db.InstanceSet("parent_ctx", parent)
 	db.InstanceSet("span", span)
+
+	if op.opt.poolWaitEvents {
+		if stats, ok := poolStats(db); ok {
+			db.InstanceSet("pool_stats", stats)
+		}
+	}
+}
+
+func (op *OpentracingPlugin) startSpan(ctx context.Context, db *gorm.DB, name OperationName, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	spanName := name.String()
+	if op.opt.spanNameFormatter != nil {
+		spanName = op.opt.spanNameFormatter(name, db.Statement)
+	}
+
+	opts = append(opts, trace.WithSpanKind(op.opt.spanKind))
+	ctx, span := op.tracer.Start(ctx, spanName, opts...)
+
+	span.SetAttributes(op.dbSystem)
+	span.SetAttributes(op.opt.semconv.dbName.String(db.Name()))
+	if op.opt.connectionName != "" {
+		span.SetAttributes(_connectionNameKey.String(op.opt.connectionName))
+	}
+	if len(op.serverAttrs) > 0 {
+		span.SetAttributes(op.serverAttrs...)
+	}
+	if len(op.opt.attrs) > 0 {
+		span.SetAttributes(op.opt.attrs...)
+	}
+
+	if len(op.opt.baggageKeys) > 0 {
+		bag := baggage.FromContext(ctx)
+		for _, key := range op.opt.baggageKeys {
+			if m := bag.Member(key); m.Key() != "" {
+				span.SetAttributes(attribute.String(key, m.Value()))
+			}
+		}
+	}
+
+	if op.opt.recordCaller {
+		span.SetAttributes(callerAttributes()...)
+	}
+
+	return ctx, span
+}
+
+// finishingSpan returns the span started before the statement. With WithMinSpanDuration
+// the span is created afterwards for slow statements only, fast ones are recorded as an
+// event on the parent span.
+func (op *OpentracingPlugin) finishingSpan(ctx context.Context, db *gorm.DB, name interface{}, start time.Time, cost time.Duration, sql string) (trace.Span, bool) {
+	span, isExist := db.InstanceGet("span")
+	if spanner, ok := span.(trace.Span); isExist && ok {
+		return spanner, true
+	}
+
+	traced, _ := db.InstanceGet("traced")
+	opName, ok := name.(OperationName)
+	if traced != true || !ok || op.opt.minSpanDuration <= 0 {
+		return nil, false
+	}
+
+	if cost < op.opt.minSpanDuration {
+		attrs := append(op.statementAttrs(sql), attribute.Int64(_durationKey, cost.Microseconds()))
+		trace.SpanFromContext(ctx).AddEvent(opName.String(), trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+		return nil, false
+	}
+
+	_, spanner := op.startSpan(ctx, db, opName, trace.WithTimestamp(start))
+	return spanner, true
+}
+
+func (op *OpentracingPlugin) statementAttrs(sql string) []attribute.KeyValue {
+	if op.opt.maxSqlLength > 0 && len(sql) > op.opt.maxSqlLength {
+		return []attribute.KeyValue{op.opt.semconv.dbStatement.String(truncate(sql, op.opt.maxSqlLength)), attribute.Bool(_truncatedKey, true)}
+	}
+
+	return []attribute.KeyValue{op.opt.semconv.dbStatement.String(sql)}
+}
+
+type skipTracingKey struct{}
+
+// SkipTracing returns a context for which the plugin creates no spans,
+// e.g. for lock polling or health probes.
+func SkipTracing(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipTracingKey{}, true)
+}
+
+func tracingSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipTracingKey{}).(bool)
+	return skip
+}
+
+// tracing reports whether spans may be created under ctx.
+func (op *OpentracingPlugin) tracing(ctx context.Context) bool {
+	if tracingSkipped(ctx) {
+		return false
+	}
+
+	if !op.opt.requireParent {
+		return true
+	}
+	if foreign, ok := op.opt.tracer.(foreignTracer); ok {
+		return foreign.hasParent(ctx)
+	}
+	return trace.SpanContextFromContext(ctx).IsValid()
+}
+
+func (op *OpentracingPlugin) ignored(stmt *gorm.Statement) bool {
+	if _, ok := op.opt.ignoredTables[stmt.Table]; ok {
+		return true
+	}
+
+	return op.opt.ignoreFn != nil && op.opt.ignoreFn(stmt)
+}
+
+func (op *OpentracingPlugin) sampled(name OperationName, stmt *gorm.Statement) bool {
+	return op.opt.sampler == nil || op.opt.sampler(name, stmt)
+}
+
+func (op *OpentracingPlugin) isSpanError(err error) bool {
+	return op.opt.errorTagHook != nil && op.isFailure(err)
+}
+
+// isFailure reports whether err counts as a failed statement, see WithErrorFilter.
+func (op *OpentracingPlugin) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return op.opt.errorFilter == nil || op.opt.errorFilter(err)
 }
 
-func (op OpentracingPlugin) extractAfter(db *gorm.DB) {
+func (op *OpentracingPlugin) isSlow(cost time.Duration) bool {
+	return op.opt.slowThreshold > 0 && cost >= op.opt.slowThreshold
+}
+
+func (op *OpentracingPlugin) isWriteOp(name interface{}) bool {
+	switch name {
+	case op.opt.createOpName, op.opt.updateOpName, op.opt.deleteOpName:
+		return true
+	}
+
+	return false
+}
+
+func (op *OpentracingPlugin) extractAfter(db *gorm.DB) {
 	if db == nil || db.Statement == nil {
 		return
 	}
@@ -116,27 +342,171 @@ func (op OpentracingPlugin) extractAfter(db *gorm.DB) {
 		return
 	}
 
-	var startTime time.Time
-	st, isExist := db.InstanceGet("start_time")
-	if isExist {
-		startTime, _ = st.(time.Time)
+	startTime, _ := instanceTime(db, "start_time")
+	spanCost := time.Since(startTime)
+	// 语句本身的耗时, 不含preload和关联语句
+	cost := spanCost
+	if c, _ := db.InstanceGet("statement_cost"); c != nil {
+		cost, _ = c.(time.Duration)
+	} else if start, ok := instanceTime(db, "statement_start"); ok {
+		cost = time.Since(start)
+	}
+	name, _ := db.InstanceGet("operation")
+	if counted, _ := db.InstanceGet("inflight"); counted == true {
+		if opName, ok := name.(OperationName); ok {
+			op.inflight.dec(opName)
+		}
+		db.InstanceSet("inflight", false)
 	}
 
 	// 通过stmt反解SQL
-	sql := db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)
+	sql := statementSQL(db)
+	if op.opt.logSqlParameters {
+		sql = db.Dialector.Explain(sql, op.scrubVars(db.Statement.Vars)...)
+	}
+	// 脱敏: 字面量替换为 ?
+	if op.opt.obfuscateSql {
+		sql = obfuscateSQL(sql, doubleQuotedIdents(db.Dialector.Name()))
+	}
+
+	if parent, ok := db.InstanceGet("parent_ctx"); ok {
+		if parentCtx, ok := parent.(context.Context); ok {
+			db.Statement.Context = parentCtx
+		}
+	}
+
+	operation := sqlOperation(sql)
 
 	// 结束span
-	span, isExist := db.InstanceGet("span")
-	if spanner, ok := span.(trace.Span); isExist && ok {
-		spanner.SetAttributes(util.DBStatementKey.String(sql))
+	spanner, spanned := op.finishingSpan(ctx, db, name, startTime, spanCost, sql)
+	if spanned {
+		if op.isSpanError(db.Error) {
+			op.opt.errorTagHook(spanner, db.Error)
+			spanner.SetAttributes(_errorTypeKey.String(classifyError(db.Error)))
+		}
+		spanner.SetAttributes(op.statementAttrs(sql)...)
+		if operation != "" {
+			spanner.SetAttributes(op.opt.semconv.dbOperation.String(operation))
+		}
+		if db.Statement.Table != "" {
+			spanner.SetAttributes(op.opt.semconv.dbTable.String(db.Statement.Table))
+		}
+		if op.opt.replicaPools != nil {
+			spanner.SetAttributes(op.opt.replicaPools.role(db.Statement.ConnPool))
+		}
+		if hit, ok := db.InstanceGet(_cacheHitInstance); ok {
+			spanner.SetAttributes(_cacheHitKey.Bool(hit == true))
+		}
+		if coalesced, _ := db.InstanceGet(_coalescedInstance); coalesced == true {
+			spanner.SetAttributes(_coalescedKey.Bool(true))
+		}
+		if op.isWriteOp(name) {
+			spanner.SetAttributes(attribute.Int64(_rowsAffectedLogKey, db.RowsAffected))
+		}
+		if op.opt.poolWaitEvents {
+			recordPoolWait(db, spanner)
+		}
+		if op.opt.logResult && db.Error == nil && name == op.opt.queryOpName {
+			if result, ok := encodeResult(db.Statement, op.opt.resultMaxRows, op.opt.resultMaxBytes); ok {
+				spanner.AddEvent(_resultEvent, trace.WithAttributes(
+					attribute.String(_resultLogKey, result),
+					attribute.Int(_resultRowsKey, resultRows(db.Statement)),
+				))
+				op.statementf(ctx, name, "[gorm] name:%s rows: %d result: %s", db.Name(), resultRows(db.Statement), result)
+			}
+		}
+		for _, extract := range op.opt.attrExtractors {
+			spanner.SetAttributes(extract(db)...)
+		}
+		if op.isSlow(cost) {
+			spanner.AddEvent(_slowQueryEvent, trace.WithAttributes(
+				_slowQueryKey.Bool(true),
+				attribute.Int64(_slowQueryThresholdKey, op.opt.slowThreshold.Milliseconds()),
+			))
+		}
+		// 慢查询附带执行计划
+		if op.opt.explainThreshold > 0 && cost >= op.opt.explainThreshold && db.Error == nil && name == op.opt.queryOpName {
+			explain(ctx, db, spanner)
+		}
 		spanner.End()
 	}
 
-	log.Get(ctx).Debugf("[gorm] name:%s cost: %v sql: %s", db.Name(), time.Since(startTime), sql)
+	withStatementSpan(db, spanner, spanned)
+
+	op.recordMetrics(ctx, db, name, operation, cost)
+	if op.opt.replicaPools != nil {
+		op.opt.replicaPools.observe(db.Statement.ConnPool, cost)
+	}
+	if op.isFailure(db.Error) {
+		op.logError(ctx, db, sql)
+	}
+	if op.opt.auditSink != nil && op.isWriteOp(name) {
+		op.audit(ctx, db, operation)
+	}
+
+	if op.isSlow(cost) {
+		op.opt.logger.Warnf(ctx, "[gorm] slow query name:%s cost: %v threshold: %v rows: %d caller: %s sql: %s",
+			db.Name(), cost, op.opt.slowThreshold, db.RowsAffected, callerLocation(), op.redactedSQL(db, sql))
+	}
+
+	op.statementf(ctx, name, "[gorm] name:%s cost: %v rows: %d sql: %s", db.Name(), cost, db.RowsAffected, sql)
+}
+
+// redactedSQL never exposes raw parameters: they are either scrubbed or left as placeholders.
+func (op *OpentracingPlugin) redactedSQL(db *gorm.DB, sql string) string {
+	switch {
+	case op.opt.obfuscateSql:
+		return sql
+	case op.opt.logSqlParameters && op.opt.paramScrubber != nil:
+		return sql
+	default:
+		return statementSQL(db)
+	}
+}
+
+func (op *OpentracingPlugin) scrubVars(vars []interface{}) []interface{} {
+	if op.opt.paramScrubber == nil {
+		return vars
+	}
+
+	scrubbed := make([]interface{}, len(vars))
+	for i, v := range vars {
+		scrubbed[i] = op.opt.paramScrubber(i, v)
+	}
+
+	return scrubbed
+}
+
+// truncate 按字节截断, 不截断多字节字符
+func truncate(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n] + _truncatedMarker
 }
 
 type errorTagHook func(span trace.Span, err error)
 
+// paramScrubber returns the value recorded for the bind parameter at index.
+type paramScrubber func(index int, value interface{}) interface{}
+
+const _redactedParam = "<redacted>"
+
+type attributeExtractor func(db *gorm.DB) []attribute.KeyValue
+
+// sampler decides whether a statement is traced, stmt.Context carries the parent span.
+type sampler func(op OperationName, stmt *gorm.Statement) bool
+
+type spanNameFormatter func(op OperationName, stmt *gorm.Statement) string
+
+type errorFilter func(err error) bool
+
+// 查不到记录和调用方取消都不算span错误
+func defaultErrorFilter(err error) bool {
+	return !errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, context.Canceled)
+}
+
 func defaultErrorTagHook(span trace.Span, err error) {
 	span.RecordError(err)
 	span.SetStatus(codes.Error, err.Error())
@@ -144,12 +514,25 @@ func defaultErrorTagHook(span trace.Span, err error) {
 
 
 const (
-	_createOp operationName = "create"
-	_updateOp operationName = "update"
-	_queryOp  operationName = "query"
-	_deleteOp operationName = "delete"
-	_rowOp    operationName = "row"
-	_rawOp    operationName = "raw"
+	_createOp OperationName = "create"
+	_updateOp OperationName = "update"
+	_queryOp  OperationName = "query"
+	_deleteOp OperationName = "delete"
+	_rowOp    OperationName = "row"
+	_rawOp    OperationName = "raw"
+
+	_transactionOp   OperationName = "transaction"
+	_createBatchesOp OperationName = "create_batches"
+)
+
+// 用于 WithTracedOperations
+const (
+	OpCreate = _createOp
+	OpUpdate = _updateOp
+	OpQuery  = _queryOp
+	OpDelete = _deleteOp
+	OpRow    = _rowOp
+	OpRaw    = _rawOp
 )
 
 type operationStage string
@@ -171,27 +554,84 @@ const (
 	_stageAfterRow     operationStage = "otel:after_row"
 	_stageBeforeRaw    operationStage = "otel:before_raw"
 	_stageAfterRaw     operationStage = "otel:after_raw"
+	_stageMetrics      operationStage = "otel:metrics"
+
+	_stageBeforeStatement operationStage = "otel:before_statement"
+	_stageAfterStatement  operationStage = "otel:after_statement"
+
+	_stageBeginTx        operationStage = "otel:before_begin_transaction"
+	_stageBeforeCommitTx operationStage = "otel:before_commit_transaction"
+	_stageAfterCommitTx  operationStage = "otel:after_commit_transaction"
 )
 
 type options struct {
 	logResult        bool
+	resultMaxRows    int
+	resultMaxBytes   int
 	tracer           oteltrace.TracerProvider
+	meterProvider    metric.MeterProvider
+	prometheus       *PrometheusCollector
+	statsSink        StatsSink
+	logger           Logger
+	logLimiter       *logLimiter
+	errorDedup       *errorDedup
+	opLogLevels      map[OperationName]LogLevel
+	auditSink        AuditSink
+	maxTableLabels   int
+	tableNormalizer  func(table string) string
+	tracerName       string
+	tracerVersion    string
 	logSqlParameters bool
+	paramScrubber    paramScrubber
+	obfuscateSql     bool
+	sqlCommenter     bool
+	maxSqlLength     int
+	explainThreshold time.Duration
+	slowThreshold    time.Duration
+	recordCaller     bool
+	minSpanDuration  time.Duration
+	poolWaitEvents   bool
 	errorTagHook     errorTagHook
-
-	createOpName operationName
-	updateOpName operationName
-	queryOpName  operationName
-	deleteOpName operationName
-	rowOpName    operationName
-	rawOpName    operationName
+	errorFilter      errorFilter
+	attrs            []attribute.KeyValue
+	attrExtractors   []attributeExtractor
+	baggageKeys      []string
+	spanKind         trace.SpanKind
+	semconv          semconvKeys
+	dbSystem         attribute.KeyValue
+	connectionName   string
+	replicaPools     *replicaPools
+
+	spanNameFormatter spanNameFormatter
+	ignoredTables     map[string]struct{}
+	ignoreFn          func(stmt *gorm.Statement) bool
+	tracedOps         map[OperationName]struct{}
+	sampler           sampler
+	requireParent     bool
+
+	createOpName OperationName
+	updateOpName OperationName
+	queryOpName  OperationName
+	deleteOpName OperationName
+	rowOpName    OperationName
+	rawOpName    OperationName
 }
 
 func defaultOption() *options {
 	return &options{
 		logResult:        false,
+		resultMaxRows:    _defaultResultMaxRows,
+		resultMaxBytes:   _defaultResultMaxBytes,
 		tracer:           otel.GetTracerProvider(),
+		meterProvider:    global.MeterProvider(),
+		tracerName:       _defaultTracerName,
+		tracerVersion:    _instrumentationVersion,
 		logSqlParameters: true,
+		errorTagHook:     defaultErrorTagHook,
+		errorFilter:      defaultErrorFilter,
+		logger:           nopLogger{},
+		spanKind:         trace.SpanKindClient,
+		semconv:          _semconvKeys[SemconvLegacy],
 
 		createOpName: _createOp,
 		updateOpName: _updateOp,
@@ -209,6 +649,18 @@ func WithLogResult(logResult bool) ApplyOption {
 	return func(o *options) { o.logResult = logResult }
 }
 
+// WithLogResultLimit limits the rows and bytes of query results recorded by WithLogResult.
+func WithLogResultLimit(maxRows, maxBytes int) ApplyOption {
+	return func(o *options) {
+		if maxRows > 0 {
+			o.resultMaxRows = maxRows
+		}
+		if maxBytes > 0 {
+			o.resultMaxBytes = maxBytes
+		}
+	}
+}
+
 func WithTracer(t oteltrace.TracerProvider) ApplyOption {
 	return func(o *options) {
 		if t == nil {
@@ -219,105 +671,471 @@ func WithTracer(t oteltrace.TracerProvider) ApplyOption {
 	}
 }
 
+// WithMeterProvider sets the MeterProvider statement metrics are recorded with,
+// the global one by default.
+func WithMeterProvider(mp metric.MeterProvider) ApplyOption {
+	return func(o *options) {
+		if mp == nil {
+			return
+		}
+
+		o.meterProvider = mp
+	}
+}
+
+// WithMaxTableLabels caps the distinct table label values of metrics, further tables are
+// reported as "_other_". n <= 0 means no limit.
+func WithMaxTableLabels(n int) ApplyOption {
+	return func(o *options) {
+		o.maxTableLabels = n
+	}
+}
+
+// WithTableNormalizer rewrites table names before they are used as metric labels,
+// see NormalizeNumericSuffix.
+func WithTableNormalizer(normalize func(table string) string) ApplyOption {
+	return func(o *options) {
+		o.tableNormalizer = normalize
+	}
+}
+
+// WithPrometheus records statement counters and durations into c.
+func WithPrometheus(c *PrometheusCollector) ApplyOption {
+	return func(o *options) {
+		o.prometheus = c
+	}
+}
+
+// WithStatsSink sends statement timings and counters to sink, e.g. a StatsD client from NewStatsD.
+func WithStatsSink(sink StatsSink) ApplyOption {
+	return func(o *options) {
+		o.statsSink = sink
+	}
+}
+
+// WithTracerName overrides the instrumentation scope name and version of the tracer.
+func WithTracerName(name, version string) ApplyOption {
+	return func(o *options) {
+		if name != "" {
+			o.tracerName = name
+		}
+		if version != "" {
+			o.tracerVersion = version
+		}
+	}
+}
+
 func WithSqlParameters(logSqlParameters bool) ApplyOption {
 	return func(o *options) {
 		o.logSqlParameters = logSqlParameters
 	}
 }
 
-type operationName string
+// WithErrorTagHook overrides how statement errors are recorded on spans.
+func WithErrorTagHook(hook errorTagHook) ApplyOption {
+	return func(o *options) {
+		if hook == nil {
+			return
+		}
+
+		o.errorTagHook = hook
+	}
+}
 
-func (op operationName) String() string {
-	return string(op)
+// WithLogger sets the logger of the plugin, nothing is logged by default.
+func WithLogger(l Logger) ApplyOption {
+	return func(o *options) {
+		if l != nil {
+			o.logger = l
+		}
+	}
 }
 
+// WithOperationLogLevel sets the level statement logs of op are written at, e.g.
+// WithOperationLogLevel(OpDelete, LogInfo). Operations default to LogDebug.
+func WithOperationLogLevel(op OperationName, level LogLevel) ApplyOption {
+	return func(o *options) {
+		if o.opLogLevels == nil {
+			o.opLogLevels = make(map[OperationName]LogLevel)
+		}
+		o.opLogLevels[op] = level
+	}
+}
 
-var (
-	sfg singleflight.Group
-	rwl sync.RWMutex
+// WithLogRateLimit limits per statement logs to perSecond lines with bursts of burst,
+// suppressed lines are summarized by the next logged one.
+func WithLogRateLimit(perSecond float64, burst int) ApplyOption {
+	return func(o *options) {
+		o.logLimiter = newLogLimiter(perSecond, burst)
+	}
+}
 
-	dbs = map[string]*gorm.DB{}
+// WithErrorLogDedup logs the same error, by SQL digest and error class, once per window
+// and summarizes the repeats afterwards.
+func WithErrorLogDedup(window time.Duration) ApplyOption {
+	return func(o *options) {
+		if window > 0 {
+			o.errorDedup = newErrorDedup(window)
+		}
+	}
+}
 
-	ErrNotFound = gorm.ErrRecordNotFound
-)
+// WithAuditSink duplicates create, update and delete statements to sink, e.g. AuditLogger,
+// with table, primary keys and rows affected but without parameters.
+func WithAuditSink(sink AuditSink) ApplyOption {
+	return func(o *options) {
+		o.auditSink = sink
+	}
+}
 
-func Get(ctx context.Context, name string, dsn string) (db *gorm.DB, err error) {
-	rwl.RLock()
-	if v, ok := dbs[name]; ok {
-		db = v
-		rwl.RUnlock()
-		return
+// WithErrorFilter decides which statement errors mark the span as failed,
+// by default gorm.ErrRecordNotFound and context.Canceled are ignored.
+func WithErrorFilter(filter errorFilter) ApplyOption {
+	return func(o *options) {
+		o.errorFilter = filter
 	}
-	rwl.RUnlock()
+}
+
+// WithAttributes adds static attributes to every span created by the plugin.
+func WithAttributes(attrs ...attribute.KeyValue) ApplyOption {
+	return func(o *options) {
+		o.attrs = append(o.attrs, attrs...)
+	}
+}
+
+// WithBaggageAttributes copies the given baggage members of the context onto spans.
+func WithBaggageAttributes(keys ...string) ApplyOption {
+	return func(o *options) {
+		o.baggageKeys = append(o.baggageKeys, keys...)
+	}
+}
+
+// WithAttributeExtractor adds attributes computed from the finished statement to its span,
+// e.g. tenant ID from the statement context.
+func WithAttributeExtractor(extract attributeExtractor) ApplyOption {
+	return func(o *options) {
+		if extract == nil {
+			return
+		}
+
+		o.attrExtractors = append(o.attrExtractors, extract)
+	}
+}
+
+// WithSpanKind sets the kind of spans, trace.SpanKindClient by default.
+func WithSpanKind(kind trace.SpanKind) ApplyOption {
+	return func(o *options) {
+		o.spanKind = kind
+	}
+}
+
+// WithDBSystem overrides the db.system attribute detected from the dialector name.
+func WithDBSystem(system attribute.KeyValue) ApplyOption {
+	return func(o *options) {
+		o.dbSystem = system
+	}
+}
 
-	v, _, _ := sfg.Do(name, func() (interface{}, error) {
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
-		if err != nil {
-			return nil, err
+// WithConnectionName sets db.connection.name on every span and metric, Get sets it to the registry name.
+func WithConnectionName(name string) ApplyOption {
+	return func(o *options) {
+		o.connectionName = name
+	}
+}
+
+// WithSemconvVersion selects the semantic convention version of span attributes.
+func WithSemconvVersion(version SemconvVersion) ApplyOption {
+	return func(o *options) {
+		if keys, ok := _semconvKeys[version]; ok {
+			o.semconv = keys
 		}
+	}
+}
 
-		db.Use(New(WithLogResult(false), WithSqlParameters(true)))
+// WithSpanNameFormatter customizes span names, e.g. "users.query" instead of "query".
+func WithSpanNameFormatter(f spanNameFormatter) ApplyOption {
+	return func(o *options) {
+		o.spanNameFormatter = f
+	}
+}
+
+// WithSqlParameterScrubber rewrites bind parameters before they are inlined into the
+// recorded statement, e.g. to mask emails or passwords.
+func WithSqlParameterScrubber(scrubber paramScrubber) ApplyOption {
+	return func(o *options) {
+		o.paramScrubber = scrubber
+	}
+}
+
+// WithSqlParameterAllowlist only inlines bind parameters at the given positions (0-based),
+// the others are recorded as "<redacted>".
+func WithSqlParameterAllowlist(positions ...int) ApplyOption {
+	allowed := make(map[int]struct{}, len(positions))
+	for _, i := range positions {
+		allowed[i] = struct{}{}
+	}
 
-		rwl.Lock()
-		defer rwl.Unlock()
-		dbs[name] = db
-		return db, nil
+	return WithSqlParameterScrubber(func(index int, value interface{}) interface{} {
+		if _, ok := allowed[index]; ok {
+			return value
+		}
+		return _redactedParam
 	})
+}
 
-	return v.(*gorm.DB), err
+// WithSqlObfuscation replaces literal values in the recorded statement with "?",
+// regardless of WithSqlParameters.
+func WithSqlObfuscation(obfuscate bool) ApplyOption {
+	return func(o *options) {
+		o.obfuscateSql = obfuscate
+	}
+}
+
+// WithIgnoredTables skips tracing for statements on the given tables.
+func WithIgnoredTables(tables ...string) ApplyOption {
+	return func(o *options) {
+		if o.ignoredTables == nil {
+			o.ignoredTables = make(map[string]struct{}, len(tables))
+		}
+
+		for _, table := range tables {
+			o.ignoredTables[table] = struct{}{}
+		}
+	}
+}
+
+// WithIgnore skips tracing for statements matching fn.
+func WithIgnore(fn func(stmt *gorm.Statement) bool) ApplyOption {
+	return func(o *options) {
+		o.ignoreFn = fn
+	}
+}
+
+// WithSampler traces only statements for which s returns true, on top of the tracer's own sampler,
+// e.g. 1% of queries but all deletes.
+func WithSampler(s sampler) ApplyOption {
+	return func(o *options) {
+		o.sampler = s
+	}
+}
+
+// WithRequireParentSpan only creates spans when ctx already carries a valid span context,
+// so background jobs without tracing context do not produce root spans.
+func WithRequireParentSpan(require bool) ApplyOption {
+	return func(o *options) {
+		o.requireParent = require
+	}
 }
 
+// WithTracedOperations only traces the given operations, all operations are traced by default.
+func WithTracedOperations(ops ...OperationName) ApplyOption {
+	return func(o *options) {
+		o.tracedOps = make(map[OperationName]struct{}, len(ops))
+		for _, op := range ops {
+			o.tracedOps[op] = struct{}{}
+		}
+	}
+}
+
+func (o *options) traced(op OperationName) bool {
+	if o.tracedOps == nil {
+		return true
+	}
+
+	_, ok := o.tracedOps[op]
+	return ok
+}
+
+// WithSqlCommenter prepends the span context to outgoing SQL as a sqlcommenter
+// comment, e.g. /*traceparent='00-...-01'*/, so database logs can be correlated with traces.
+// It fails the registration on a db with PrepareStmt, with ErrSqlCommenterPrepareStmt, and
+// statements of sessions with PrepareStmt are not commented.
+func WithSqlCommenter(enable bool) ApplyOption {
+	return func(o *options) {
+		o.sqlCommenter = enable
+	}
+}
+
+// WithMaxSQLLength truncates the recorded statement to n bytes, n <= 0 means no limit.
+func WithMaxSQLLength(n int) ApplyOption {
+	return func(o *options) {
+		o.maxSqlLength = n
+	}
+}
+
+// WithSlowQueryThreshold marks statements taking at least d as slow, they are counted by
+// db.client.slow_queries and get a "slow_query" span event. 0 disables it.
+func WithSlowQueryThreshold(d time.Duration) ApplyOption {
+	return func(o *options) {
+		o.slowThreshold = d
+	}
+}
+
+// WithExplainThreshold attaches the EXPLAIN plan of queries slower than d as a span event, 0 disables it.
+func WithExplainThreshold(d time.Duration) ApplyOption {
+	return func(o *options) {
+		o.explainThreshold = d
+	}
+}
+
+// WithCaller records code.filepath, code.lineno and code.function of the application call site.
+func WithCaller(enable bool) ApplyOption {
+	return func(o *options) {
+		o.recordCaller = enable
+	}
+}
+
+// WithMinSpanDuration only creates spans for statements taking at least d, faster
+// statements are recorded as events on the parent span. Spans are then created after
+// the statement finishes, so statements can not be parented to them, and WithSqlCommenter
+// has no effect.
+func WithMinSpanDuration(d time.Duration) ApplyOption {
+	return func(o *options) {
+		o.minSpanDuration = d
+	}
+}
+
+// WithPoolWaitEvents adds a "pool.wait" span event when the connection pool had to wait
+// for a free connection while the statement ran, based on sql.DBStats sampling.
+func WithPoolWaitEvents(enable bool) ApplyOption {
+	return func(o *options) {
+		o.poolWaitEvents = enable
+	}
+}
+
+// OperationName is the gorm operation of a statement, e.g. OpQuery, passed to WithSampler
+// and WithSpanNameFormatter.
+type OperationName string
+
+func (op OperationName) String() string {
+	return string(op)
+}
+
+
+const _pluginName = "otel"
 
 type OpentracingPlugin struct {
-	opt *options
+	opt    *options
+	tracer trace.Tracer
+
+	dbSystem    attribute.KeyValue
+	serverAttrs []attribute.KeyValue
+	metrics     *metrics
+	tableLabels *tableLabels
+	counters    *queryCounters
+	poolWaits   *poolWaits
+	inflight    *inflight
 }
 
-func (op OpentracingPlugin) Name() string {
-	return "otel"
+func (op *OpentracingPlugin) Name() string {
+	return _pluginName
 }
 
-func (op OpentracingPlugin) Initialize(db *gorm.DB) (err error) {
+func (op *OpentracingPlugin) Initialize(db *gorm.DB) (err error) {
 	e := myError{errs: make([]string, 0, 12)}
 
+	if _, ok := op.opt.tracer.(foreignTracer); ok && op.opt.sqlCommenter {
+		return ErrSqlCommenterUnsupported
+	}
+	if op.opt.sqlCommenter && db.Config.PrepareStmt {
+		return ErrSqlCommenterPrepareStmt
+	}
+
+	op.tracer = op.opt.tracer.Tracer(op.opt.tracerName, trace.WithInstrumentationVersion(op.opt.tracerVersion))
+	op.serverAttrs = serverAttributes(db.Dialector)
+	op.dbSystem = op.opt.dbSystem
+	if !op.dbSystem.Valid() {
+		op.dbSystem = dbSystemOf(db.Dialector.Name())
+	}
+
+	op.metrics, err = newMetrics(op.opt.meterProvider, op.opt.tracerName, op.opt.tracerVersion)
+	e.add(_stageMetrics, err)
+	if d := op.opt.errorDedup; d != nil {
+		d.report = func(summaries []dedupSummary) {
+			op.logRepeats(context.Background(), summaries)
+		}
+	}
+	op.tableLabels = newTableLabels(op.opt.maxTableLabels, op.opt.tableNormalizer)
+	op.inflight = newInflight(op.opt.createOpName, op.opt.updateOpName, op.opt.queryOpName,
+		op.opt.deleteOpName, op.opt.rowOpName, op.opt.rawOpName)
+	e.add(_stageMetrics, op.registerInflightGauge(op.opt.meterProvider))
+
+	// span包住关联写入和preload, 使它们成为子span, 语句本身另外计时.
+	// After会排到最后, 语句结束用下一个回调的Before
+
 	// create
-	err = db.Callback().Create().Before("gorm:create").Register(_stageBeforeCreate.Name(), op.beforeCreate)
-	e.add(_stageBeforeCreate, err)
-	err = db.Callback().Create().After("gorm:create").Register(_stageAfterCreate.Name(), op.after)
-	e.add(_stageAfterCreate, err)
+	if op.opt.traced(_createOp) {
+		err = db.Callback().Create().Before("gorm:save_before_associations").Register(_stageBeforeCreate.Name(), op.beforeCreate)
+		e.add(_stageBeforeCreate, err)
+		e.add(_stageBeforeStatement, db.Callback().Create().Before("gorm:create").Register(_stageBeforeStatement.Name(), op.beforeStatement))
+		e.add(_stageAfterStatement, db.Callback().Create().Before("gorm:save_after_associations").Register(_stageAfterStatement.Name(), op.afterStatement))
+		err = db.Callback().Create().After("gorm:save_after_associations").Register(_stageAfterCreate.Name(), op.after)
+		e.add(_stageAfterCreate, err)
+	}
 
 	// update
-	err = db.Callback().Update().Before("gorm:update").Register(_stageBeforeUpdate.Name(), op.beforeUpdate)
-	e.add(_stageBeforeUpdate, err)
-	err = db.Callback().Update().After("gorm:update").Register(_stageAfterUpdate.Name(), op.after)
-	e.add(_stageAfterUpdate, err)
-
-	// query
-	err = db.Callback().Query().Before("gorm:query").Register(_stageBeforeQuery.Name(), op.beforeQuery)
-	e.add(_stageBeforeQuery, err)
-	err = db.Callback().Query().After("gorm:query").Register(_stageAfterQuery.Name(), op.after)
-	e.add(_stageAfterQuery, err)
-
-	// delete
-	err = db.Callback().Delete().Before("gorm:delete").Register(_stageBeforeDelete.Name(), op.beforeDelete)
-	e.add(_stageBeforeDelete, err)
-	err = db.Callback().Delete().After("gorm:delete").Register(_stageAfterDelete.Name(), op.after)
-	e.add(_stageAfterDelete, err)
+	if op.opt.traced(_updateOp) {
+		err = db.Callback().Update().Before("gorm:save_before_associations").Register(_stageBeforeUpdate.Name(), op.beforeUpdate)
+		e.add(_stageBeforeUpdate, err)
+		e.add(_stageBeforeStatement, db.Callback().Update().Before("gorm:update").Register(_stageBeforeStatement.Name(), op.beforeStatement))
+		e.add(_stageAfterStatement, db.Callback().Update().Before("gorm:save_after_associations").Register(_stageAfterStatement.Name(), op.afterStatement))
+		err = db.Callback().Update().After("gorm:save_after_associations").Register(_stageAfterUpdate.Name(), op.after)
+		e.add(_stageAfterUpdate, err)
+	}
+
+	// query, 语句开始于before_query
+	if op.opt.traced(_queryOp) {
+		err = db.Callback().Query().Before("gorm:query").Register(_stageBeforeQuery.Name(), op.beforeQuery)
+		e.add(_stageBeforeQuery, err)
+		e.add(_stageAfterStatement, db.Callback().Query().Before("gorm:preload").Register(_stageAfterStatement.Name(), op.afterStatement))
+		err = db.Callback().Query().After("gorm:preload").Register(_stageAfterQuery.Name(), op.after)
+		e.add(_stageAfterQuery, err)
+	}
+
+	// delete, 语句结束于after_delete
+	if op.opt.traced(_deleteOp) {
+		err = db.Callback().Delete().Before("gorm:delete_before_associations").Register(_stageBeforeDelete.Name(), op.beforeDelete)
+		e.add(_stageBeforeDelete, err)
+		e.add(_stageBeforeStatement, db.Callback().Delete().Before("gorm:delete").Register(_stageBeforeStatement.Name(), op.beforeStatement))
+		err = db.Callback().Delete().After("gorm:delete").Register(_stageAfterDelete.Name(), op.after)
+		e.add(_stageAfterDelete, err)
+	}
 
 	// row
-	err = db.Callback().Row().Before("gorm:row").Register(_stageBeforeRow.Name(), op.beforeRow)
-	e.add(_stageBeforeRow, err)
-	err = db.Callback().Row().After("gorm:row").Register(_stageAfterRow.Name(), op.after)
-	e.add(_stageAfterRow, err)
+	if op.opt.traced(_rowOp) {
+		err = db.Callback().Row().Before("gorm:row").Register(_stageBeforeRow.Name(), op.beforeRow)
+		e.add(_stageBeforeRow, err)
+		err = db.Callback().Row().After("gorm:row").Register(_stageAfterRow.Name(), op.after)
+		e.add(_stageAfterRow, err)
+	}
 
 	// raw
-	err = db.Callback().Raw().Before("gorm:raw").Register(_stageBeforeRaw.Name(), op.beforeRaw)
-	e.add(_stageBeforeRaw, err)
-	err = db.Callback().Raw().After("gorm:raw").Register(_stageAfterRaw.Name(), op.after)
-	e.add(_stageAfterRaw, err)
+	if op.opt.traced(_rawOp) {
+		err = db.Callback().Raw().Before("gorm:raw").Register(_stageBeforeRaw.Name(), op.beforeRaw)
+		e.add(_stageBeforeRaw, err)
+		err = db.Callback().Raw().After("gorm:raw").Register(_stageAfterRaw.Name(), op.after)
+		e.add(_stageAfterRaw, err)
+	}
+
+	// gorm为写操作开启的事务
+	e.add(_stageBeginTx, db.Callback().Create().Before("gorm:begin_transaction").Register(_stageBeginTx.Name(), op.beforeBeginTx))
+	e.add(_stageBeforeCommitTx, db.Callback().Create().Before("gorm:commit_or_rollback_transaction").Register(_stageBeforeCommitTx.Name(), op.beforeCommitTx))
+	e.add(_stageAfterCommitTx, db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register(_stageAfterCommitTx.Name(), op.afterCommitTx))
+	e.add(_stageBeginTx, db.Callback().Update().Before("gorm:begin_transaction").Register(_stageBeginTx.Name(), op.beforeBeginTx))
+	e.add(_stageBeforeCommitTx, db.Callback().Update().Before("gorm:commit_or_rollback_transaction").Register(_stageBeforeCommitTx.Name(), op.beforeCommitTx))
+	e.add(_stageAfterCommitTx, db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register(_stageAfterCommitTx.Name(), op.afterCommitTx))
+	e.add(_stageBeginTx, db.Callback().Delete().Before("gorm:begin_transaction").Register(_stageBeginTx.Name(), op.beforeBeginTx))
+	e.add(_stageBeforeCommitTx, db.Callback().Delete().Before("gorm:commit_or_rollback_transaction").Register(_stageBeforeCommitTx.Name(), op.beforeCommitTx))
+	e.add(_stageAfterCommitTx, db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register(_stageAfterCommitTx.Name(), op.afterCommitTx))
 
 	return e.toError()
 }
 
+func lookupPlugin(db *gorm.DB) (*OpentracingPlugin, bool) {
+	p, ok := db.Config.Plugins[_pluginName].(*OpentracingPlugin)
+	return p, ok
+}
+
 func New(opts ...ApplyOption) gorm.Plugin {
 	dst := defaultOption()
 
@@ -325,5 +1143,5 @@ func New(opts ...ApplyOption) gorm.Plugin {
 		apply(dst)
 	}
 
-	return OpentracingPlugin{opt: dst}
+	return &OpentracingPlugin{opt: dst, counters: &queryCounters{}, poolWaits: &poolWaits{}}
 }
@@ -0,0 +1,117 @@
+package gorm
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GetFromEnv is Get with the connection declared by environment variables prefixed with
+// DB_<NAME>_, NAME being name upper-cased with other characters than letters and digits
+// replaced by "_":
+//
+//	DB_USERS_DRIVER            mysql (default), postgres, sqlite, clickhouse
+//	DB_USERS_DSN               full DSN, takes precedence over the parts below
+//	DB_USERS_HOST, _PORT, _USER, _PASSWORD, _DBNAME
+//	DB_USERS_PARAMS            e.g. parseTime=true&loc=UTC
+//	DB_USERS_MAX_OPEN_CONNS, _MAX_IDLE_CONNS
+//	DB_USERS_CONN_MAX_LIFETIME, _CONN_MAX_IDLE_TIME   e.g. 5m
+//	DB_USERS_LAZY              true
+func GetFromEnv(ctx context.Context, name string, opts ...ConnOption) (*gorm.DB, error) {
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+
+	c, err := envConfig(name, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, dsn, err := c.dsn()
+	if err != nil {
+		return nil, err
+	}
+	return GetWithDriver(ctx, name, driver, dsn, append(c.options(), opts...)...)
+}
+
+func envPrefix(name string) string {
+	return "DB_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name) + "_"
+}
+
+func envConfig(name string, getenv func(string) string) (ConnectionConfig, error) {
+	prefix := envPrefix(name)
+	env := func(key string) string {
+		return getenv(prefix + key)
+	}
+
+	c := ConnectionConfig{
+		Driver:   Driver(env("DRIVER")),
+		DSN:      env("DSN"),
+		Host:     env("HOST"),
+		User:     env("USER"),
+		Password: env("PASSWORD"),
+		DBName:   env("DBNAME"),
+	}
+
+	var err error
+	if c.Port, err = envInt(env("PORT")); err != nil {
+		return c, err
+	}
+	if c.MaxOpenConns, err = envInt(env("MAX_OPEN_CONNS")); err != nil {
+		return c, err
+	}
+	if c.MaxIdleConns, err = envInt(env("MAX_IDLE_CONNS")); err != nil {
+		return c, err
+	}
+	if c.ConnMaxLifetime, err = envDuration(env("CONN_MAX_LIFETIME")); err != nil {
+		return c, err
+	}
+	if c.ConnMaxIdleTime, err = envDuration(env("CONN_MAX_IDLE_TIME")); err != nil {
+		return c, err
+	}
+	if v := env("LAZY"); v != "" {
+		if c.Lazy, err = strconv.ParseBool(v); err != nil {
+			return c, err
+		}
+	}
+	if v := env("PARAMS"); v != "" {
+		values, err := url.ParseQuery(v)
+		if err != nil {
+			return c, err
+		}
+		c.Params = make(map[string]string, len(values))
+		for k := range values {
+			c.Params[k] = values.Get(k)
+		}
+	}
+
+	return c, nil
+}
+
+func envInt(v string) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func envDuration(v string) (Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	return Duration(d), err
+}
@@ -0,0 +1,51 @@
+package gorm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvPrefix(t *testing.T) {
+	testSuites := map[string]string{
+		"users":       "DB_USERS_",
+		"user-events": "DB_USER_EVENTS_",
+		"Shard01":     "DB_SHARD01_",
+		"a.b":         "DB_A_B_",
+	}
+
+	for name, expected := range testSuites {
+		if got := envPrefix(name); got != expected {
+			t.Errorf("envPrefix %v, expects %v, but got %v", name, expected, got)
+		}
+	}
+}
+
+func TestEnvConfig(t *testing.T) {
+	env := map[string]string{
+		"DB_USERS_DRIVER":            "postgres",
+		"DB_USERS_HOST":              "10.0.0.1",
+		"DB_USERS_PORT":              "5432",
+		"DB_USERS_USER":              "app",
+		"DB_USERS_PASSWORD":          "p@ss/word",
+		"DB_USERS_DBNAME":            "users",
+		"DB_USERS_PARAMS":            "sslmode=disable",
+		"DB_USERS_MAX_OPEN_CONNS":    "20",
+		"DB_USERS_CONN_MAX_LIFETIME": "5m",
+	}
+
+	c, err := envConfig("users", func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("envConfig, expects no error, but got %v", err)
+	}
+	if c.Driver != DriverPostgres || c.Host != "10.0.0.1" || c.Port != 5432 || c.Password != "p@ss/word" {
+		t.Errorf("envConfig, expects connection parts, but got %+v", c)
+	}
+	if c.MaxOpenConns != 20 || time.Duration(c.ConnMaxLifetime) != 5*time.Minute || c.Params["sslmode"] != "disable" {
+		t.Errorf("envConfig, expects pool settings and params, but got %+v", c)
+	}
+
+	env["DB_USERS_PORT"] = "x"
+	if _, err := envConfig("users", func(key string) string { return env[key] }); err == nil {
+		t.Errorf("envConfig with invalid port, expects an error, but got nil")
+	}
+}
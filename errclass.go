@@ -0,0 +1,81 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const _errorTypeKey = attribute.Key("error.type")
+
+// error classes reported as error.type
+const (
+	ErrClassDuplicateKey      = "duplicate_key"
+	ErrClassForeignKey        = "foreign_key"
+	ErrClassLockWaitTimeout   = "lock_wait_timeout"
+	ErrClassDeadlock          = "deadlock"
+	ErrClassQueryTimeout      = "query_timeout"
+	ErrClassTooManyConns      = "too_many_connections"
+	ErrClassAccessDenied      = "access_denied"
+	ErrClassSyntax            = "syntax_error"
+	ErrClassNoSuchTable       = "no_such_table"
+	ErrClassDataTooLong       = "data_too_long"
+	ErrClassConnectionRefused = "connection_refused"
+	ErrClassBadConnection     = "bad_connection"
+	ErrClassTimeout           = "timeout"
+	ErrClassCanceled          = "canceled"
+	ErrClassNotFound          = "not_found"
+	ErrClassOther             = "_OTHER"
+)
+
+var _mysqlErrClasses = map[uint16]string{
+	1062: ErrClassDuplicateKey,
+	1586: ErrClassDuplicateKey,
+	1451: ErrClassForeignKey,
+	1452: ErrClassForeignKey,
+	1205: ErrClassLockWaitTimeout,
+	1213: ErrClassDeadlock,
+	3024: ErrClassQueryTimeout,
+	1040: ErrClassTooManyConns,
+	1045: ErrClassAccessDenied,
+	1064: ErrClassSyntax,
+	1146: ErrClassNoSuchTable,
+	1406: ErrClassDataTooLong,
+}
+
+// classifyError maps err to a low cardinality class, MySQL errors without a
+// dedicated class are reported by their error number.
+func classifyError(err error) string {
+	var mysqlErr *gomysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		if class, ok := _mysqlErrClasses[mysqlErr.Number]; ok {
+			return class
+		}
+		return strconv.Itoa(int(mysqlErr.Number))
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrClassNotFound
+	case errors.Is(err, context.Canceled):
+		return ErrClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrClassConnectionRefused
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, gomysql.ErrInvalidConn), errors.Is(err, syscall.ECONNRESET):
+		return ErrClassBadConnection
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrClassTimeout
+	}
+
+	return ErrClassOther
+}
@@ -0,0 +1,147 @@
+package gorm
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// _maxDedupEntries bounds tracked fingerprints, errors beyond it are logged as they come.
+const _maxDedupEntries = 1024
+
+// errorDedup collapses repeated errors of the same fingerprint within a window, repeats
+// are counted and summarized once the window has passed.
+type errorDedup struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[uint64]*dedupEntry
+	timer   *time.Timer
+
+	// report logs the summaries of windows that passed without another error, so that the
+	// last repeats are not lost when errors stop. Nothing is flushed while it is nil.
+	report func(summaries []dedupSummary)
+}
+
+type dedupEntry struct {
+	since   time.Time
+	repeats int64
+	msg     string
+}
+
+type dedupSummary struct {
+	msg     string
+	repeats int64
+}
+
+func newErrorDedup(window time.Duration) *errorDedup {
+	return &errorDedup{window: window, entries: make(map[uint64]*dedupEntry)}
+}
+
+// observe reports whether an error with fingerprint key should be logged at now, along
+// with summaries of fingerprints whose window has passed.
+func (d *errorDedup) observe(key uint64, msg string, now time.Time) (bool, []dedupSummary) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	summaries := d.expire(now)
+	if e, ok := d.entries[key]; ok {
+		if e.repeats++; e.repeats == 1 {
+			d.schedule(e.since.Add(d.window).Sub(now))
+		}
+		return false, summaries
+	}
+	if len(d.entries) < _maxDedupEntries {
+		d.entries[key] = &dedupEntry{since: now, msg: msg}
+	}
+	return true, summaries
+}
+
+// expire removes the fingerprints whose window has passed at now and returns the
+// summaries of those repeated, the caller holds d.mu.
+func (d *errorDedup) expire(now time.Time) []dedupSummary {
+	var summaries []dedupSummary
+	for k, e := range d.entries {
+		if now.Sub(e.since) < d.window {
+			continue
+		}
+		if e.repeats > 0 {
+			summaries = append(summaries, dedupSummary{msg: e.msg, repeats: e.repeats})
+		}
+		delete(d.entries, k)
+	}
+	return summaries
+}
+
+// schedule flushes after delay unless a flush is pending, the caller holds d.mu.
+func (d *errorDedup) schedule(delay time.Duration) {
+	if d.report == nil || d.timer != nil {
+		return
+	}
+	d.timer = time.AfterFunc(delay, d.flush)
+}
+
+// flush reports the repeats of passed windows, and schedules the next flush while
+// fingerprints with repeats remain.
+func (d *errorDedup) flush() {
+	d.mu.Lock()
+	d.timer = nil
+	now := time.Now()
+	summaries := d.expire(now)
+
+	var next time.Time
+	for _, e := range d.entries {
+		if e.repeats > 0 && (next.IsZero() || e.since.Before(next)) {
+			next = e.since
+		}
+	}
+	if !next.IsZero() {
+		d.schedule(next.Add(d.window).Sub(now))
+	}
+	report := d.report
+	d.mu.Unlock()
+
+	if len(summaries) > 0 {
+		report(summaries)
+	}
+}
+
+// errorFingerprint identifies an error by the SQL digest and the error class, unclassified
+// errors by their message.
+func errorFingerprint(sql string, err error, quotedIdents bool) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(obfuscateSQL(sql, quotedIdents)))
+	class := classifyError(err)
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(class))
+	if class == ErrClassOther {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(err.Error()))
+	}
+
+	return h.Sum64()
+}
+
+func (op *OpentracingPlugin) logError(ctx context.Context, db *gorm.DB, sql string) {
+	msg := "[gorm] name:" + db.Name() + " error: " + db.Error.Error() + " sql: " + op.redactedSQL(db, sql)
+
+	d := op.opt.errorDedup
+	if d == nil {
+		op.opt.logger.Errorf(ctx, "%s", msg)
+		return
+	}
+
+	ok, summaries := d.observe(errorFingerprint(statementSQL(db), db.Error, doubleQuotedIdents(db.Dialector.Name())), msg, time.Now())
+	op.logRepeats(ctx, summaries)
+	if ok {
+		op.opt.logger.Errorf(ctx, "%s", msg)
+	}
+}
+
+func (op *OpentracingPlugin) logRepeats(ctx context.Context, summaries []dedupSummary) {
+	for _, s := range summaries {
+		op.opt.logger.Errorf(ctx, "%s (repeated %d more times in %v)", s.msg, s.repeats, op.opt.errorDedup.window)
+	}
+}
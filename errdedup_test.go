@@ -0,0 +1,56 @@
+package gorm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorDedup(t *testing.T) {
+	start := time.Unix(0, 0)
+	type step struct {
+		key       uint64
+		offset    time.Duration
+		logged    bool
+		summaries int
+	}
+	steps := []step{
+		{1, 0, true, 0},
+		{1, time.Second, false, 0},
+		{2, time.Second, true, 0},
+		{1, 2 * time.Second, false, 0},
+		{2, 11 * time.Second, true, 1},
+		{1, 12 * time.Second, true, 0},
+		{2, 15 * time.Second, false, 0},
+		{2, 30 * time.Second, true, 1},
+	}
+
+	d := newErrorDedup(10 * time.Second)
+	for i, s := range steps {
+		logged, summaries := d.observe(s.key, "msg", start.Add(s.offset))
+		if logged != s.logged || len(summaries) != s.summaries {
+			t.Errorf("observe step %d, expects %v/%v, but got %v/%v", i, s.logged, s.summaries, logged, len(summaries))
+		}
+	}
+}
+
+func TestErrorDedupFlush(t *testing.T) {
+	reported := make(chan []dedupSummary, 1)
+	d := newErrorDedup(20 * time.Millisecond)
+	d.report = func(summaries []dedupSummary) {
+		reported <- summaries
+	}
+
+	now := time.Now()
+	d.observe(1, "msg", now)
+	d.observe(1, "msg", now)
+	d.observe(1, "msg", now)
+
+	select {
+	case summaries := <-reported:
+		if len(summaries) != 1 || summaries[0].repeats != 2 {
+			t.Errorf("flush, expects %v, but got %v", []dedupSummary{{msg: "msg", repeats: 2}}, summaries)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("flush, expects %v, but got %v", "summaries", "nothing")
+	}
+}
@@ -0,0 +1,97 @@
+package gorm
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+const _registryEventsMetric = "db.client.registry.events"
+
+var _registryEventKey = attribute.Key("db.registry.event")
+
+// EventType is a change of a registered connection.
+type EventType string
+
+const (
+	// EventOpened is sent when a name is opened for the first time.
+	EventOpened EventType = "opened"
+	// EventReopened is sent when a name is opened again after Close or eviction, or
+	// swapped by Replace.
+	EventReopened EventType = "reopened"
+	// EventEvicted is sent when SetIdleTTL, SetMaxPools or the tenant bound evicts a name.
+	EventEvicted EventType = "evicted"
+	// EventClosed is sent by Close.
+	EventClosed EventType = "closed"
+	// EventFailover is sent when a connection opened by GetWithFailover moves to its next DSN,
+	// Err holds the dial or statement error causing it.
+	EventFailover EventType = "failover"
+	// EventHealthFailed is sent when Ping or HealthReport fails, Err holds the cause.
+	EventHealthFailed EventType = "health_failed"
+)
+
+// Event is sent to the handlers registered by OnEvent.
+type Event struct {
+	Type EventType
+	Name string
+	Err  error
+}
+
+var (
+	handlersMu sync.RWMutex
+	handlers   []func(Event)
+
+	// opened are the names opened at least once, guarded by rwl.
+	opened = map[string]struct{}{}
+
+	eventsOnce    sync.Once
+	eventsCounter syncint64.Counter
+)
+
+// OnEvent calls fn for every registry event, e.g. to log pool churn. fn runs on the
+// goroutine changing the registry and must not block.
+func OnEvent(fn func(Event)) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+
+	handlers = append(handlers, fn)
+}
+
+// openedEvent records name as opened and returns the event to emit, the caller holds rwl.
+func openedEvent(name string) EventType {
+	if _, ok := opened[name]; ok {
+		return EventReopened
+	}
+	opened[name] = struct{}{}
+	return EventOpened
+}
+
+// emit counts the event in db.client.registry.events of the global meter provider and
+// passes it to the handlers, it must not be called while holding rwl.
+func emit(typ EventType, name string, err error) {
+	eventsOnce.Do(func() {
+		meter := global.MeterProvider().Meter(_defaultTracerName, metric.WithInstrumentationVersion(_instrumentationVersion))
+		eventsCounter, _ = meter.SyncInt64().Counter(_registryEventsMetric,
+			instrument.WithUnit(unit.Dimensionless),
+			instrument.WithDescription("Number of connection registry events."),
+		)
+	})
+	if eventsCounter != nil {
+		eventsCounter.Add(context.Background(), 1, _connectionNameKey.String(name), _registryEventKey.String(string(typ)))
+	}
+
+	handlersMu.RLock()
+	hs := handlers
+	handlersMu.RUnlock()
+
+	e := Event{Type: typ, Name: name, Err: err}
+	for _, h := range hs {
+		h(e)
+	}
+}
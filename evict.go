@@ -0,0 +1,147 @@
+package gorm
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	evictMu     sync.Mutex
+	stopJanitor chan struct{}
+
+	// maxPools bounds the registered connections, guarded by rwl.
+	maxPools int
+	// pinned are the names exempt from eviction, guarded by rwl.
+	pinned = map[string]struct{}{}
+)
+
+// SetIdleTTL closes registered connections unused for ttl, i.e. no Get returned them and
+// no statement ran on them, e.g. for processes touching thousands of tenant databases.
+// Evicted pools are closed once their running statements finish and Get opens them again
+// on next use, so callers should get the pool per use instead of keeping it.
+// Pinned connections are kept, see Pin. ttl <= 0 disables idle eviction.
+func SetIdleTTL(ttl time.Duration) {
+	evictMu.Lock()
+	defer evictMu.Unlock()
+
+	if stopJanitor != nil {
+		close(stopJanitor)
+		stopJanitor = nil
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	stopJanitor = make(chan struct{})
+	go janitor(ttl, stopJanitor)
+}
+
+// Pin exempts the connection registered as name from SetIdleTTL and SetMaxPools, for pools
+// Get can't open again by name, e.g. ones opened by a helper owning the DSN and reached
+// with Lookup. The default connection and those of GetWithDialector are always exempt.
+// name may be registered before or after the call.
+func Pin(name string) {
+	rwl.Lock()
+	defer rwl.Unlock()
+
+	pinned[name] = struct{}{}
+}
+
+// SetMaxPools bounds the number of registered connections, opening one more evicts the
+// least recently used one like SetIdleTTL. n <= 0 removes the bound.
+func SetMaxPools(n int) {
+	rwl.Lock()
+	defer rwl.Unlock()
+
+	maxPools = n
+}
+
+func janitor(ttl time.Duration, stop chan struct{}) {
+	interval := ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			evictIdle(now, ttl)
+		}
+	}
+}
+
+func evictIdle(now time.Time, ttl time.Duration) {
+	victims := map[string]*connection{}
+
+	rwl.Lock()
+	for name, c := range dbs {
+		if c.evictable(name) && c.idle(now, ttl) && !c.acquired() {
+			delete(dbs, name)
+			victims[name] = c
+		}
+	}
+	rwl.Unlock()
+
+	for name, c := range victims {
+		go c.drain()
+		emit(EventEvicted, name, nil)
+	}
+}
+
+// overflow removes the least recently used connections other than keep while more than
+// maxPools are registered, the caller holds rwl and closes the returned pools.
+func overflow(keep string) map[string]*connection {
+	victims := map[string]*connection{}
+	for maxPools > 0 && len(dbs) > maxPools {
+		var (
+			oldest string
+			last   int64
+		)
+		for name, c := range dbs {
+			used := atomic.LoadInt64(&c.lastUsed)
+			if name != keep && c.evictable(name) && !c.acquired() && (oldest == "" || used < last) {
+				oldest, last = name, used
+			}
+		}
+		if oldest == "" {
+			break
+		}
+		victims[oldest] = dbs[oldest]
+		delete(dbs, oldest)
+	}
+	return victims
+}
+
+// evictable reports whether c may be evicted, i.e. Get can open it again by name and
+// callers don't expect it to stay, the caller holds rwl.
+func (c *connection) evictable(name string) bool {
+	if _, ok := pinned[name]; ok {
+		return false
+	}
+	return name != defaultName && c.dialector == nil
+}
+
+func (c *connection) touch(now time.Time) {
+	atomic.StoreInt64(&c.lastUsed, now.UnixNano())
+}
+
+// idle reports whether c was unused for ttl. Statements run on a pool kept by the caller
+// count as use, they are seen through the statement counter of the plugin.
+func (c *connection) idle(now time.Time, ttl time.Duration) bool {
+	if op, ok := lookupPlugin(c.db); ok {
+		if queries := atomic.LoadInt64(&op.counters.queries); queries != atomic.LoadInt64(&c.queries) {
+			atomic.StoreInt64(&c.queries, queries)
+			c.touch(now)
+		}
+	}
+	if sqlDB, err := c.db.DB(); err == nil && sqlDB.Stats().InUse > 0 {
+		c.touch(now)
+	}
+
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastUsed))) > ttl
+}
@@ -0,0 +1,61 @@
+package gorm
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const _explainEvent = "explain"
+
+var _explainPlanKey = keyWithPrefix("explain.plan")
+
+// explain runs EXPLAIN for the executed statement on the same connection pool,
+// bypassing callbacks so it is not traced itself. Failures are ignored.
+func explain(ctx context.Context, db *gorm.DB, span trace.Span) {
+	if db.Statement.ConnPool == nil || db.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	prefix, ok := explainPrefix(db.Dialector.Name())
+	if !ok {
+		return
+	}
+
+	// ClickHouse按行返回文本格式的计划, 其余方言返回单行JSON
+	rows, err := db.Statement.ConnPool.QueryContext(ctx, prefix+db.Statement.SQL.String(), db.Statement.Vars...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if rows.Scan(&line) != nil {
+			return
+		}
+		lines = append(lines, line)
+	}
+	if rows.Err() != nil || len(lines) == 0 {
+		return
+	}
+
+	span.AddEvent(_explainEvent, trace.WithAttributes(attribute.String(_explainPlanKey, strings.Join(lines, "\n"))))
+}
+
+func explainPrefix(dialector string) (string, bool) {
+	switch dialector {
+	case "mysql":
+		return "EXPLAIN FORMAT=JSON ", true
+	case "postgres":
+		return "EXPLAIN (FORMAT JSON) ", true
+	case "clickhouse":
+		return "EXPLAIN ", true
+	}
+
+	return "", false
+}
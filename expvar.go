@@ -0,0 +1,56 @@
+package gorm
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+const _expvarName = "gorm"
+
+var _expvarOnce sync.Once
+
+// queryCounters are always maintained by the plugin, they are cheap and back expvar.
+type queryCounters struct {
+	queries int64
+	errors  int64
+}
+
+func (c *queryCounters) add(failed bool) {
+	atomic.AddInt64(&c.queries, 1)
+	if failed {
+		atomic.AddInt64(&c.errors, 1)
+	}
+}
+
+// PublishExpvar publishes statement counters and pool stats of every connection registered
+// by Get under the "gorm" expvar, served by /debug/vars. Calling it more than once is a no-op.
+func PublishExpvar() {
+	_expvarOnce.Do(func() {
+		expvar.Publish(_expvarName, expvar.Func(expvarSnapshot))
+	})
+}
+
+func expvarSnapshot() interface{} {
+	rwl.RLock()
+	defer rwl.RUnlock()
+
+	snapshot := make(map[string]interface{}, len(dbs))
+	for name, c := range dbs {
+		vars := map[string]int64{}
+		if op, ok := lookupPlugin(c.db); ok {
+			vars["queries"] = atomic.LoadInt64(&op.counters.queries)
+			vars["errors"] = atomic.LoadInt64(&op.counters.errors)
+		}
+		if sqlDB, err := c.db.DB(); err == nil {
+			stats := sqlDB.Stats()
+			vars["open_conns"] = int64(stats.OpenConnections)
+			vars["in_use"] = int64(stats.InUse)
+			vars["idle"] = int64(stats.Idle)
+			vars["wait_count"] = stats.WaitCount
+		}
+		snapshot[name] = vars
+	}
+
+	return snapshot
+}
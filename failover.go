@@ -0,0 +1,286 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+)
+
+// _failoverStrikes 连续多少条语句失败后切换DSN
+const _failoverStrikes = 3
+
+var ErrFailoverUnsupported = errors.New("gorm: failover dsns are only supported by the mysql, postgres and sqlite drivers")
+
+// GetWithFailover is GetWithDriver with an ordered list of DSNs, e.g. a primary/standby
+// MySQL pair without a proxy. New connections dial the current DSN and fail over to the
+// next ones when it can't be reached, at open as well as when broken connections are
+// replaced while serving queries. The pool also fails over after 3 statements in a row
+// failed with a read only server, e.g. a demoted primary, or with a broken connection on
+// a connection which never ran a statement, and then drops its connections to the
+// previous DSN. Broken connections which served before, e.g. idle ones after a restart of
+// the server, are replaced by dialing again and don't count. Each move
+// sends EventFailover with the error causing it. The pool stays on the DSN it failed
+// over to until that one fails too.
+func GetWithFailover(ctx context.Context, name string, driver Driver, dsns []string, opts ...ConnOption) (*gorm.DB, error) {
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+	if len(dsns) == 0 {
+		return nil, &OpenError{Name: name, Kind: ErrBadDSN, Err: errors.New("no dsn")}
+	}
+
+	return open(ctx, name, &connection{driver: driver, dsn: dsns[0], failover: dsns, opts: opts})
+}
+
+// dsns returns the DSNs of c in failover order.
+func (c *connection) dsns() []string {
+	if len(c.failover) > 0 {
+		return c.failover
+	}
+	return []string{c.dsn}
+}
+
+// failoverConnector dials the current DSN, moving to the next ones on dial errors or
+// repeated statement errors.
+type failoverConnector struct {
+	driver driver.Driver
+	name   string
+	dsns   []string
+
+	// strikes counts the statements failing in a row on the current DSN, accessed atomically
+	strikes int64
+
+	mu         sync.Mutex
+	current    int
+	connectors []driver.Connector
+}
+
+func (c *failoverConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	start := c.current
+	c.mu.Unlock()
+
+	var lastErr error
+	for i := range c.dsns {
+		idx := (start + i) % len(c.dsns)
+
+		connector, err := c.connector(idx)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		conn, err := connector.Connect(ctx)
+		if err == nil {
+			if idx != start {
+				c.failover(start, idx, lastErr)
+			}
+			return &failoverConn{Conn: conn, connector: c, idx: idx}, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (c *failoverConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *failoverConnector) connector(idx int) (driver.Connector, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connectors[idx] == nil {
+		connector, err := openConnector(c.driver, c.dsns[idx])
+		if err != nil {
+			return nil, err
+		}
+		c.connectors[idx] = connector
+	}
+	return c.connectors[idx], nil
+}
+
+// failover moves the pool from DSN from to to, unless a concurrent dial already moved it,
+// err is why from couldn't be reached.
+func (c *failoverConnector) failover(from, to int, err error) {
+	c.mu.Lock()
+	moved := c.current == from
+	if moved {
+		c.current = to
+		atomic.StoreInt64(&c.strikes, 0)
+	}
+	c.mu.Unlock()
+
+	if moved {
+		emit(EventFailover, c.name, err)
+	}
+}
+
+// observe counts the statement errors of connections to DSN idx, failing over to the
+// next DSN once the current one failed _failoverStrikes statements in a row.
+func (c *failoverConnector) observe(idx int, err error) {
+	if !isFailoverError(err) {
+		if err == nil && atomic.LoadInt64(&c.strikes) != 0 {
+			atomic.StoreInt64(&c.strikes, 0)
+		}
+		return
+	}
+	if !c.serving(idx) || atomic.AddInt64(&c.strikes, 1) < _failoverStrikes {
+		return
+	}
+	c.failover(idx, (idx+1)%len(c.dsns), err)
+}
+
+// serving reports whether idx is the current DSN.
+func (c *failoverConnector) serving(idx int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.current == idx
+}
+
+// isFailoverError reports statement errors meaning the server behind the DSN can't serve
+// the pool any more, rather than a bad statement.
+func isFailoverError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// read_only_sql_transaction, 认证失败只在拨号时出现, 由Connect切换
+		return pgErr.Code == "25006"
+	}
+	var mysqlErr *gomysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// --read-only/super_read_only, read only mode
+		return mysqlErr.Number == 1290 || mysqlErr.Number == 1836
+	}
+
+	return isBrokenConn(err)
+}
+
+// isBrokenConn reports errors of connections which can't reach the server.
+func isBrokenConn(err error) bool {
+	switch classifyError(err) {
+	case ErrClassBadConnection, ErrClassConnectionRefused:
+		return true
+	}
+	return false
+}
+
+// failoverConn reports the statement errors of a connection to its connector, and is
+// discarded by the pool once the connector failed over from its DSN.
+type failoverConn struct {
+	driver.Conn
+	connector *failoverConnector
+	idx       int
+	// used is set once a statement succeeded, the pool uses a connection from one goroutine at a time
+	used bool
+}
+
+// observe reports the statement error to the connector, unless the connection broke after
+// serving: idle connections all break once when the server restarts.
+func (c *failoverConn) observe(err error) {
+	if err == nil {
+		c.used = true
+	} else if c.used && isBrokenConn(err) {
+		return
+	}
+	c.connector.observe(c.idx, err)
+}
+
+func (c *failoverConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = pc.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	c.observe(err)
+	return stmt, err
+}
+
+func (c *failoverConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var (
+		tx  driver.Tx
+		err error
+	)
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = bc.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	c.observe(err)
+	return tx, err
+}
+
+func (c *failoverConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	res, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.observe(err)
+	}
+	return res, err
+}
+
+func (c *failoverConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		c.observe(err)
+	}
+	return rows, err
+}
+
+func (c *failoverConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *failoverConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *failoverConn) ResetSession(ctx context.Context) error {
+	if !c.IsValid() {
+		return driver.ErrBadConn
+	}
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid drops connections to a DSN the connector failed over from.
+func (c *failoverConn) IsValid() bool {
+	if !c.connector.serving(c.idx) {
+		return false
+	}
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
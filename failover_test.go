@@ -0,0 +1,92 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+// restartServer is a server whose connections break when it restarts.
+type restartServer struct {
+	generation int
+}
+
+func (s *restartServer) Connect(context.Context) (driver.Conn, error) {
+	return &restartConn{server: s, generation: s.generation}, nil
+}
+
+func (s *restartServer) Driver() driver.Driver {
+	return nil
+}
+
+type restartConn struct {
+	driver.Conn
+	server     *restartServer
+	generation int
+}
+
+func (c *restartConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	if c.generation != c.server.generation {
+		return nil, driver.ErrBadConn
+	}
+	return nil, nil
+}
+
+func TestFailoverStaleConnections(t *testing.T) {
+	primary := &restartServer{}
+	c := &failoverConnector{name: "failover", dsns: []string{"primary", "standby"}, connectors: []driver.Connector{primary, &restartServer{}}}
+	ctx := context.Background()
+
+	conns := make([]driver.QueryerContext, _failoverStrikes)
+	for i := range conns {
+		conn, err := c.Connect(ctx)
+		if err != nil {
+			t.Fatalf("Connect, expects no error, but got %v", err)
+		}
+		conns[i] = conn.(driver.QueryerContext)
+		if _, err = conns[i].QueryContext(ctx, "SELECT 1", nil); err != nil {
+			t.Fatalf("QueryContext, expects no error, but got %v", err)
+		}
+	}
+
+	// 主库重启后空闲连接各失败一次, 不切换
+	primary.generation++
+	for _, conn := range conns {
+		if _, err := conn.QueryContext(ctx, "SELECT 1", nil); err != driver.ErrBadConn {
+			t.Errorf("QueryContext on a stale connection, expects %v, but got %v", driver.ErrBadConn, err)
+		}
+	}
+	if !c.serving(0) {
+		t.Errorf("failover after stale connections broke, expects %v, but got %v", false, true)
+	}
+
+	// 新拨的连接也失败才切换
+	for i := 0; i < _failoverStrikes; i++ {
+		conn, _ := c.Connect(ctx)
+		primary.generation++
+		_, _ = conn.(driver.QueryerContext).QueryContext(ctx, "SELECT 1", nil)
+	}
+	if !c.serving(1) {
+		t.Errorf("failover after fresh connections broke, expects %v, but got %v", true, false)
+	}
+}
+
+func TestIsFailoverError(t *testing.T) {
+	testSuites := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"read only":     {err: &gomysql.MySQLError{Number: 1290}, expected: true},
+		"access denied": {err: &gomysql.MySQLError{Number: 1045}, expected: false},
+		"bad conn":      {err: driver.ErrBadConn, expected: true},
+		"nil":           {err: nil, expected: false},
+	}
+
+	for name, ts := range testSuites {
+		if got := isFailoverError(ts.err); got != ts.expected {
+			t.Errorf("isFailoverError %v, expects %v, but got %v", name, ts.expected, got)
+		}
+	}
+}
@@ -3,10 +3,30 @@ module github.com/go-grom/gorm
 go 1.14
 
 require (
+	github.com/aws/aws-sdk-go-v2 v1.16.2
+	github.com/aws/aws-sdk-go-v2/config v1.15.3
+	github.com/aws/aws-sdk-go-v2/feature/rds/auth v1.1.10
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/hashicorp/vault/api v1.5.0
+	github.com/jackc/pgconn v1.11.0
+	github.com/jackc/pgx/v4 v4.15.0
 	github.com/jinzhu/inflection v1.0.0
 	github.com/jinzhu/now v1.1.4
+	github.com/mattn/go-sqlite3 v1.14.12
+	github.com/opentracing/opentracing-go v1.2.0
+	github.com/prometheus/client_golang v1.12.1
 	go.opentelemetry.io/otel v1.6.3
+	go.opentelemetry.io/otel/metric v0.28.0
 	go.opentelemetry.io/otel/trace v1.6.3
+	go.uber.org/zap v1.21.0
+	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	gopkg.in/DataDog/dd-trace-go.v1 v1.38.1
+	gopkg.in/yaml.v3 v3.0.0
+	gorm.io/driver/clickhouse v0.3.1
 	gorm.io/driver/mysql v1.3.3
+	gorm.io/driver/postgres v1.3.4
+	gorm.io/driver/sqlite v1.3.1
+	gorm.io/plugin/dbresolver v1.1.0
 )
@@ -0,0 +1,75 @@
+package gorm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const _pingTimeout = 2 * time.Second
+
+// Status is the health of a registered connection.
+type Status struct {
+	Healthy bool
+	Latency time.Duration
+	Err     error
+}
+
+// Ping checks that the registered connection name can reach its database, it gives up
+// after 2s unless ctx expires earlier. Unknown names return ErrNotFound.
+func Ping(ctx context.Context, name string) error {
+	// 健康检查不算使用, 不刷新lastUsed
+	rwl.RLock()
+	c, ok := dbs[name]
+	rwl.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+
+	err := ping(ctx, c.db)
+	if err != nil {
+		emit(EventHealthFailed, name, err)
+	}
+	return err
+}
+
+func ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, _pingTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// HealthReport pings every registered connection concurrently, e.g. for readiness probes.
+func HealthReport(ctx context.Context) map[string]Status {
+	names := registeredNames()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		report = make(map[string]Status, len(names))
+	)
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := Ping(ctx, name)
+			status := Status{Healthy: err == nil, Latency: time.Since(start), Err: err}
+
+			mu.Lock()
+			report[name] = status
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	return report
+}
@@ -0,0 +1,67 @@
+package gorm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+const _inflightMetric = "db.client.operations.in_flight"
+
+var _inflightOpKey = keyWithPrefix("operation")
+
+// inflight counts statements between their before and after callbacks by operation.
+// The map is built once and only read afterwards, counters are updated atomically.
+type inflight struct {
+	counts map[OperationName]*int64
+}
+
+func newInflight(names ...OperationName) *inflight {
+	counts := make(map[OperationName]*int64, len(names))
+	for _, name := range names {
+		counts[name] = new(int64)
+	}
+
+	return &inflight{counts: counts}
+}
+
+// inc reports whether name is counted, only then dec must be called.
+func (f *inflight) inc(name OperationName) bool {
+	c, ok := f.counts[name]
+	if ok {
+		atomic.AddInt64(c, 1)
+	}
+	return ok
+}
+
+func (f *inflight) dec(name OperationName) {
+	if c, ok := f.counts[name]; ok {
+		atomic.AddInt64(c, -1)
+	}
+}
+
+func (op *OpentracingPlugin) registerInflightGauge(mp metric.MeterProvider) error {
+	meter := mp.Meter(op.opt.tracerName, metric.WithInstrumentationVersion(op.opt.tracerVersion))
+
+	gauge, err := meter.AsyncInt64().Gauge(_inflightMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of database client operations in progress."),
+	)
+	if err != nil {
+		return err
+	}
+
+	return meter.RegisterCallback([]instrument.Asynchronous{gauge}, func(ctx context.Context) {
+		for name, c := range op.inflight.counts {
+			attrs := []attribute.KeyValue{op.dbSystem, attribute.String(_inflightOpKey, name.String())}
+			if op.opt.connectionName != "" {
+				attrs = append(attrs, _connectionNameKey.String(op.opt.connectionName))
+			}
+			gauge.Observe(ctx, atomic.LoadInt64(c), attrs...)
+		}
+	})
+}
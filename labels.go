@@ -0,0 +1,61 @@
+package gorm
+
+import (
+	"regexp"
+	"sync"
+)
+
+const _otherTable = "_other_"
+
+var _numericSuffix = regexp.MustCompile(`(_[0-9]+)+$`)
+
+// NormalizeNumericSuffix folds dynamically named tables into one label,
+// e.g. events_2024_01 becomes events_*.
+func NormalizeNumericSuffix(table string) string {
+	return _numericSuffix.ReplaceAllString(table, "_*")
+}
+
+// tableLabels bounds the distinct table label values of metrics, tables seen after
+// the limit is reached are reported as "_other_".
+type tableLabels struct {
+	max       int
+	normalize func(table string) string
+
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+func newTableLabels(max int, normalize func(table string) string) *tableLabels {
+	return &tableLabels{max: max, normalize: normalize, seen: map[string]struct{}{}}
+}
+
+func (l *tableLabels) label(table string) string {
+	if l.normalize != nil {
+		table = l.normalize(table)
+	}
+	if l.max <= 0 || table == "" {
+		return table
+	}
+
+	l.mu.RLock()
+	_, ok := l.seen[table]
+	full := len(l.seen) >= l.max
+	l.mu.RUnlock()
+	if ok {
+		return table
+	}
+	if full {
+		return _otherTable
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[table]; !ok {
+		if len(l.seen) >= l.max {
+			return _otherTable
+		}
+		l.seen[table] = struct{}{}
+	}
+
+	return table
+}
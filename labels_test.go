@@ -0,0 +1,34 @@
+package gorm
+
+import "testing"
+
+func TestNormalizeNumericSuffix(t *testing.T) {
+	for table, expected := range map[string]string{
+		"events_2024_01": "events_*",
+		"orders_7":       "orders_*",
+		"users":          "users",
+		"t2_users":       "t2_users",
+		"v2":             "v2",
+	} {
+		if result := NormalizeNumericSuffix(table); result != expected {
+			t.Errorf("normalize %v, expects %v, but got %v", table, expected, result)
+		}
+	}
+}
+
+func TestTableLabels(t *testing.T) {
+	labels := newTableLabels(2, NormalizeNumericSuffix)
+
+	for _, c := range []struct{ table, expected string }{
+		{"users", "users"},
+		{"events_2024_01", "events_*"},
+		{"orders", _otherTable},
+		{"events_2024_02", "events_*"},
+		{"users", "users"},
+		{"", ""},
+	} {
+		if result := labels.label(c.table); result != c.expected {
+			t.Errorf("label of %v, expects %v, but got %v", c.table, c.expected, result)
+		}
+	}
+}
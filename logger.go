@@ -0,0 +1,73 @@
+package gorm
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	_traceIDField = "trace_id"
+	_spanIDField  = "span_id"
+)
+
+// Logger receives the plugin's own log lines, ctx is the statement context so that
+// implementations can attach request scoped fields.
+type Logger interface {
+	Debugf(ctx context.Context, format string, args ...interface{})
+	Infof(ctx context.Context, format string, args ...interface{})
+	Warnf(ctx context.Context, format string, args ...interface{})
+	Errorf(ctx context.Context, format string, args ...interface{})
+}
+
+// LogLevel is the level statement logs are written at, see WithOperationLogLevel.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+	LogOff
+)
+
+func (op *OpentracingPlugin) logf(ctx context.Context, level LogLevel, format string, args ...interface{}) {
+	switch level {
+	case LogDebug:
+		op.opt.logger.Debugf(ctx, format, args...)
+	case LogInfo:
+		op.opt.logger.Infof(ctx, format, args...)
+	case LogWarn:
+		op.opt.logger.Warnf(ctx, format, args...)
+	case LogError:
+		op.opt.logger.Errorf(ctx, format, args...)
+	}
+}
+
+// statementLevel returns the log level of statement logs of an operation, DEBUG by default.
+func (op *OpentracingPlugin) statementLevel(name interface{}) LogLevel {
+	if opName, ok := name.(OperationName); ok {
+		if level, ok := op.opt.opLogLevels[opName]; ok {
+			return level
+		}
+	}
+
+	return LogDebug
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(context.Context, string, ...interface{}) {}
+func (nopLogger) Infof(context.Context, string, ...interface{})  {}
+func (nopLogger) Warnf(context.Context, string, ...interface{})  {}
+func (nopLogger) Errorf(context.Context, string, ...interface{}) {}
+
+// spanIDs returns the ids of the span active in ctx for log correlation.
+func spanIDs(ctx context.Context) (traceID, spanID string, ok bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", "", false
+	}
+
+	return sc.TraceID().String(), sc.SpanID().String(), true
+}
@@ -0,0 +1,49 @@
+package gorm
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru tracks the most recently used keys, bounded to max keys when max > 0.
+type lru struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRU(max int) *lru {
+	return &lru{max: max, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// touch marks key as most recently used and returns the keys pushed out by it.
+func (l *lru) touch(key string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.items[key]; ok {
+		l.ll.MoveToFront(e)
+		return nil
+	}
+	l.items[key] = l.ll.PushFront(key)
+
+	var evicted []string
+	for l.max > 0 && l.ll.Len() > l.max {
+		e := l.ll.Back()
+		l.ll.Remove(e)
+		delete(l.items, e.Value.(string))
+		evicted = append(evicted, e.Value.(string))
+	}
+	return evicted
+}
+
+func (l *lru) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.items[key]; ok {
+		l.ll.Remove(e)
+		delete(l.items, key)
+	}
+}
@@ -0,0 +1,31 @@
+package gorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLRUTouch(t *testing.T) {
+	l := newLRU(2)
+	testSuites := []struct {
+		key      string
+		expected []string
+	}{
+		{"a", nil},
+		{"b", nil},
+		{"a", nil},
+		{"c", []string{"b"}},
+		{"d", []string{"a"}},
+	}
+
+	for _, s := range testSuites {
+		if got := l.touch(s.key); !reflect.DeepEqual(got, s.expected) {
+			t.Errorf("touch %v, expects %v, but got %v", s.key, s.expected, got)
+		}
+	}
+
+	l.remove("c")
+	if got := l.touch("e"); got != nil {
+		t.Errorf("touch %v after remove, expects %v, but got %v", "e", nil, got)
+	}
+}
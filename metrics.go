@@ -0,0 +1,224 @@
+package gorm
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+	"gorm.io/gorm"
+)
+
+const (
+	_operationDurationMetric = "db.client.operation.duration"
+	_errorsMetric            = "db.client.errors"
+	_rowsAffectedMetric      = "db.client.rows_affected"
+	_returnedRowsMetric      = "db.client.response.returned_rows"
+	_slowQueriesMetric       = "db.client.slow_queries"
+	_txDurationMetric        = "db.client.transaction.duration"
+	_txRollbacksMetric       = "db.client.transaction.rollbacks"
+	_txCommitErrorsMetric    = "db.client.transaction.commit_errors"
+	_poolWaitTimeMetric      = "db.client.connections.wait_time"
+	_poolWaitsMetric         = "db.client.connections.waits"
+)
+
+const (
+	_statusOk    = "ok"
+	_statusError = "error"
+)
+
+var _statusKey = keyWithPrefix("status")
+
+type metrics struct {
+	duration syncfloat64.Histogram
+	errors   syncint64.Counter
+
+	rowsAffected syncint64.Histogram
+	returnedRows syncint64.Histogram
+	slowQueries  syncint64.Counter
+
+	txDuration     syncfloat64.Histogram
+	txRollbacks    syncint64.Counter
+	txCommitErrors syncint64.Counter
+
+	poolWaitTime syncfloat64.Counter
+	poolWaits    syncint64.Counter
+}
+
+func newMetrics(mp metric.MeterProvider, name, version string) (*metrics, error) {
+	meter := mp.Meter(name, metric.WithInstrumentationVersion(version))
+
+	duration, err := meter.SyncFloat64().Histogram(_operationDurationMetric,
+		instrument.WithUnit(unit.Unit("s")),
+		instrument.WithDescription("Duration of database client operations."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	errs, err := meter.SyncInt64().Counter(_errorsMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of failed database client operations."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := meter.SyncInt64().Histogram(_rowsAffectedMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of rows affected by write operations."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	returnedRows, err := meter.SyncInt64().Histogram(_returnedRowsMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of rows returned by queries."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	slowQueries, err := meter.SyncInt64().Counter(_slowQueriesMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of operations exceeding the slow query threshold."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	txDuration, err := meter.SyncFloat64().Histogram(_txDurationMetric,
+		instrument.WithUnit(unit.Unit("s")),
+		instrument.WithDescription("Duration of transactions from begin to commit or rollback."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	txRollbacks, err := meter.SyncInt64().Counter(_txRollbacksMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of rolled back transactions."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	txCommitErrors, err := meter.SyncInt64().Counter(_txCommitErrorsMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of transactions whose commit failed."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	poolWaitTime, err := meter.SyncFloat64().Counter(_poolWaitTimeMetric,
+		instrument.WithUnit(unit.Unit("s")),
+		instrument.WithDescription("Total time spent waiting for a connection from the pool."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	poolWaits, err := meter.SyncInt64().Counter(_poolWaitsMetric,
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of connections waited for from the pool."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metrics{
+		duration:       duration,
+		errors:         errs,
+		rowsAffected:   rowsAffected,
+		returnedRows:   returnedRows,
+		slowQueries:    slowQueries,
+		txDuration:     txDuration,
+		txRollbacks:    txRollbacks,
+		txCommitErrors: txCommitErrors,
+		poolWaitTime:   poolWaitTime,
+		poolWaits:      poolWaits,
+	}, nil
+}
+
+func (op *OpentracingPlugin) recordMetrics(ctx context.Context, db *gorm.DB, name interface{}, operation string, cost time.Duration) {
+	if opName, ok := name.(OperationName); ok && operation == "" {
+		operation = strings.ToUpper(opName.String())
+	}
+
+	status := _statusOk
+	if op.isFailure(db.Error) {
+		status = _statusError
+	}
+	op.counters.add(status == _statusError)
+
+	table := op.tableLabels.label(db.Statement.Table)
+
+	if op.metrics != nil {
+		attrs := op.metricAttrs(operation, table)
+		op.metrics.duration.Record(ctx, cost.Seconds(), append(attrs, attribute.String(_statusKey, status))...)
+		if status == _statusError {
+			op.metrics.errors.Add(ctx, 1, append(attrs, _errorTypeKey.String(classifyError(db.Error)))...)
+		} else if op.isWriteOp(name) {
+			op.metrics.rowsAffected.Record(ctx, db.RowsAffected, attrs...)
+		} else if name == op.opt.queryOpName {
+			// 查询时RowsAffected即扫描到的行数
+			op.metrics.returnedRows.Record(ctx, db.RowsAffected, attrs...)
+		}
+		if op.isSlow(cost) {
+			op.metrics.slowQueries.Add(ctx, 1, attrs...)
+		}
+		op.recordPoolWaitTime(ctx, db)
+	}
+
+	if op.opt.prometheus != nil {
+		op.opt.prometheus.observe(op.opt.connectionName, operation, table, status, cost)
+	}
+
+	if op.opt.statsSink != nil {
+		op.recordStats(operation, table, status, cost)
+	}
+}
+
+// recordTxMetrics records a top level transaction, err means it was rolled back unless
+// commitFailed.
+func (op *OpentracingPlugin) recordTxMetrics(ctx context.Context, cost time.Duration, err error, commitFailed bool) {
+	if op.metrics == nil {
+		return
+	}
+
+	attrs := []attribute.KeyValue{op.dbSystem}
+	if op.opt.connectionName != "" {
+		attrs = append(attrs, _connectionNameKey.String(op.opt.connectionName))
+	}
+
+	status := _statusOk
+	switch {
+	case commitFailed:
+		status = _statusError
+		op.metrics.txCommitErrors.Add(ctx, 1, attrs...)
+	case err != nil:
+		status = _statusError
+		op.metrics.txRollbacks.Add(ctx, 1, attrs...)
+	}
+	op.metrics.txDuration.Record(ctx, cost.Seconds(), append(attrs, attribute.String(_statusKey, status))...)
+}
+
+// metricAttrs returns the low cardinality dimensions shared by statement metrics.
+func (op *OpentracingPlugin) metricAttrs(operation, table string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{op.dbSystem, op.opt.semconv.dbOperation.String(operation)}
+	if op.opt.connectionName != "" {
+		attrs = append(attrs, _connectionNameKey.String(op.opt.connectionName))
+	}
+	if table != "" {
+		attrs = append(attrs, op.opt.semconv.dbTable.String(table))
+	}
+
+	return attrs
+}
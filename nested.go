@@ -0,0 +1,67 @@
+package gorm
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	_preloadKey     = attribute.Key("gorm.preload")
+	_associationKey = attribute.Key("gorm.association")
+)
+
+type nestedRelationsKey struct{}
+
+// nestedRelations maps tables of a statement's relations to the relation name, so statements
+// issued by Preload or association saves can be tagged with the relation they load.
+type nestedRelations struct {
+	key    attribute.Key
+	tables map[string]string
+}
+
+func withNestedRelations(ctx context.Context, stmt *gorm.Statement, query bool) context.Context {
+	if stmt.Schema == nil || len(stmt.Schema.Relationships.Relations) == 0 {
+		return ctx
+	}
+
+	key := _associationKey
+	if query {
+		if len(stmt.Preloads) == 0 {
+			return ctx
+		}
+		key = _preloadKey
+	}
+
+	return context.WithValue(ctx, nestedRelationsKey{}, nestedRelations{key: key, tables: relationTables(stmt.Schema)})
+}
+
+func nestedRelationOf(ctx context.Context, stmt *gorm.Statement) (attribute.KeyValue, bool) {
+	rels, ok := ctx.Value(nestedRelationsKey{}).(nestedRelations)
+	if !ok {
+		return attribute.KeyValue{}, false
+	}
+
+	name, ok := rels.tables[stmt.Table]
+	if !ok {
+		return attribute.KeyValue{}, false
+	}
+
+	return rels.key.String(name), true
+}
+
+func relationTables(s *schema.Schema) map[string]string {
+	tables := make(map[string]string, len(s.Relationships.Relations))
+	for name, rel := range s.Relationships.Relations {
+		if rel.FieldSchema != nil {
+			tables[rel.FieldSchema.Table] = name
+		}
+		if rel.JoinTable != nil {
+			tables[rel.JoinTable.Table] = name
+		}
+	}
+
+	return tables
+}
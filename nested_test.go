@@ -0,0 +1,75 @@
+package gorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type warnLogger struct {
+	mu    sync.Mutex
+	warns []string
+}
+
+func (l *warnLogger) Debugf(context.Context, string, ...interface{}) {}
+func (l *warnLogger) Infof(context.Context, string, ...interface{})  {}
+func (l *warnLogger) Errorf(context.Context, string, ...interface{}) {}
+
+func (l *warnLogger) Warnf(_ context.Context, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warns = append(l.warns, fmt.Sprintf(format, args...))
+}
+
+func TestStatementCostExcludesPreload(t *testing.T) {
+	type nestedOrder struct {
+		ID     int
+		UserID int
+	}
+	type nestedUser struct {
+		ID     int
+		Orders []nestedOrder `gorm:"foreignKey:UserID"`
+	}
+
+	db, err := gorm.Open(sqlite.Open("file:nested?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open, expects no error, but got %v", err)
+	}
+	logger := &warnLogger{}
+	if err = db.Use(New(WithSlowQueryThreshold(50*time.Millisecond), WithLogger(logger))); err != nil {
+		t.Fatalf("Use, expects no error, but got %v", err)
+	}
+	if err = db.AutoMigrate(&nestedUser{}, &nestedOrder{}); err != nil {
+		t.Fatalf("AutoMigrate, expects no error, but got %v", err)
+	}
+	if err = db.Create(&nestedUser{ID: 1, Orders: []nestedOrder{{ID: 1}}}).Error; err != nil {
+		t.Fatalf("Create, expects no error, but got %v", err)
+	}
+
+	// preload的查询变慢, 外层查询本身仍然很快
+	err = db.Callback().Query().Before("gorm:query").Register("test:slow_preload", func(db *gorm.DB) {
+		if db.Statement.Table == "nested_orders" {
+			time.Sleep(60 * time.Millisecond)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Register, expects no error, but got %v", err)
+	}
+
+	var users []nestedUser
+	if err = db.Preload("Orders").Find(&users).Error; err != nil || len(users) != 1 || len(users[0].Orders) != 1 {
+		t.Fatalf("Preload, expects 1 user with 1 order, but got %v, %v", users, err)
+	}
+
+	for _, warn := range logger.warns {
+		if strings.Contains(warn, "`nested_users`") {
+			t.Errorf("slow query log, expects only the preload, but got %v", warn)
+		}
+	}
+}
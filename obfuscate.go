@@ -0,0 +1,81 @@
+package gorm
+
+import "strings"
+
+// obfuscateSQL replaces string, numeric and hex literals in sql with "?",
+// leaving identifiers, keywords and placeholders untouched. With quotedIdents "..." is a
+// quoted identifier, as in Postgres and SQLite, instead of a string literal as in MySQL.
+func obfuscateSQL(sql string, quotedIdents bool) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || (c == '"' && !quotedIdents):
+			j := i + 1
+			for j < len(sql) {
+				if sql[j] == '\\' {
+					j += 2
+					continue
+				}
+				if sql[j] == c {
+					// doubled quote is an escaped quote
+					if j+1 < len(sql) && sql[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			b.WriteByte('?')
+			i = j + 1
+		case c == '`' || c == '"':
+			j := i + 1
+			for j < len(sql) {
+				if sql[j] == c {
+					// doubled quote is an escaped quote
+					if j+1 < len(sql) && sql[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(sql) {
+				b.WriteString(sql[i:])
+				return b.String()
+			}
+			b.WriteString(sql[i : j+1])
+			i = j + 1
+		case isDigit(c) && (i == 0 || !isIdentByte(sql[i-1])):
+			j := i
+			for j < len(sql) && (isIdentByte(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// doubleQuotedIdents reports whether dialect quotes identifiers with ", every supported
+// database but MySQL does.
+func doubleQuotedIdents(dialect string) bool {
+	return dialect != "mysql"
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,30 @@
+package gorm
+
+import "testing"
+
+func TestObfuscateSQL(t *testing.T) {
+	for sql, expected := range map[string]string{
+		"SELECT * FROM `users` WHERE `users`.`id` = 10":                   "SELECT * FROM `users` WHERE `users`.`id` = ?",
+		"SELECT * FROM users WHERE email = 'a@b.com' AND age > 18.5":      "SELECT * FROM users WHERE email = ? AND age > ?",
+		`INSERT INTO t1 (name,note) VALUES ("jinzhu",'it''s \'ok\'')`:     "INSERT INTO t1 (name,note) VALUES (?,?)",
+		"SELECT * FROM t2 WHERE id IN (?,?) AND flag = 0x1F":              "SELECT * FROM t2 WHERE id IN (?,?) AND flag = ?",
+		"SELECT col1, t3.col2 FROM t3 WHERE t3.col3 = 'unterminated":      "SELECT col1, t3.col2 FROM t3 WHERE t3.col3 = ?",
+		"UPDATE `order_2024` SET `status`='paid' WHERE `id`=7 LIMIT 1000": "UPDATE `order_2024` SET `status`=? WHERE `id`=? LIMIT ?",
+	} {
+		if result := obfuscateSQL(sql, false); result != expected {
+			t.Errorf("obfuscate %v, expects %v, but got %v", sql, expected, result)
+		}
+	}
+}
+
+func TestObfuscateSQLQuotedIdents(t *testing.T) {
+	for sql, expected := range map[string]string{
+		`SELECT * FROM "users" WHERE "users"."email" = 'a@b.com' AND "id" = 10`: `SELECT * FROM "users" WHERE "users"."email" = ? AND "id" = ?`,
+		`INSERT INTO "t""1" ("name") VALUES ('it''s')`:                          `INSERT INTO "t""1" ("name") VALUES (?)`,
+		`SELECT "col1" FROM "unterminated`:                                      `SELECT "col1" FROM "unterminated`,
+	} {
+		if result := obfuscateSQL(sql, true); result != expected {
+			t.Errorf("obfuscate %v, expects %v, but got %v", sql, expected, result)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package gorm
+
+import (
+	"errors"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+)
+
+var (
+	ErrOpenFailed = errors.New("gorm: open connection failed")
+	ErrBadDSN     = errors.New("gorm: bad dsn")
+)
+
+// OpenError is returned by Get when a connection can't be opened. It matches ErrBadDSN
+// or ErrOpenFailed with errors.Is and unwraps to the driver error.
+type OpenError struct {
+	Name string
+	Kind error
+	Err  error
+}
+
+func (e *OpenError) Error() string {
+	return e.Kind.Error() + ": " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// validateDSN parses dsn like the driver will, so malformed DSNs fail before dialing.
+func (d Driver) validateDSN(dsn string) error {
+	var err error
+	switch d {
+	case DriverMySQL:
+		_, err = gomysql.ParseDSN(dsn)
+	case DriverPostgres:
+		_, err = pgconn.ParseConfig(dsn)
+	case DriverClickHouse:
+		_, err = clickhouseAddr(dsn)
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+package gorm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpenError(t *testing.T) {
+	driverErr := errors.New("dial tcp: connection refused")
+	err := error(&OpenError{Name: "users", Kind: ErrOpenFailed, Err: driverErr})
+
+	if !errors.Is(err, ErrOpenFailed) {
+		t.Errorf("errors.Is ErrOpenFailed, expects true, but got false")
+	}
+	if errors.Is(err, ErrBadDSN) {
+		t.Errorf("errors.Is ErrBadDSN, expects false, but got true")
+	}
+	if !errors.Is(err, driverErr) {
+		t.Errorf("errors.Is driver error, expects true, but got false")
+	}
+	if expected := "gorm: open connection failed: users: dial tcp: connection refused"; err.Error() != expected {
+		t.Errorf("Error, expects %v, but got %v", expected, err.Error())
+	}
+}
+
+func TestOpenErrorWrap(t *testing.T) {
+	err := openError("users", ErrTLSUnsupported)
+	if !errors.Is(err, ErrOpenFailed) || !errors.Is(err, ErrTLSUnsupported) {
+		t.Errorf("openError %v, expects %v, but got %v", ErrTLSUnsupported, "ErrOpenFailed wrapping it", err)
+	}
+
+	bad := error(&OpenError{Name: "users", Kind: ErrBadDSN, Err: errors.New("invalid DSN")})
+	if got := openError("users", bad); got != bad {
+		t.Errorf("openError %v, expects %v, but got %v", bad, bad, got)
+	}
+}
@@ -0,0 +1,138 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// NewOpenTracing creates the plugin reporting spans to an OpenTracing tracer, e.g. the classic
+// Jaeger client. The otel bridge only maps OpenTracing calls onto OpenTelemetry, so spans are
+// translated by a minimal TracerProvider instead: attributes become tags and events become logs.
+// Span contexts are not exposed to OpenTelemetry: WithRequireParentSpan looks for an OpenTracing
+// parent span instead, and WithSqlCommenter fails the registration with ErrSqlCommenterUnsupported.
+func NewOpenTracing(tracer opentracing.Tracer, opts ...ApplyOption) gorm.Plugin {
+	return New(append([]ApplyOption{WithTracer(&otTracerProvider{tracer: tracer})}, opts...)...)
+}
+
+var ErrSqlCommenterUnsupported = errors.New("gorm: sqlcommenter needs an OpenTelemetry tracer, OpenTracing and Datadog span contexts can't be propagated")
+
+// foreignTracer is a TracerProvider translating spans to another tracer, whose span
+// contexts OpenTelemetry can't see.
+type foreignTracer interface {
+	// hasParent reports whether ctx carries a span of the other tracer.
+	hasParent(ctx context.Context) bool
+}
+
+type otTracerProvider struct {
+	tracer opentracing.Tracer
+}
+
+func (p *otTracerProvider) hasParent(ctx context.Context) bool {
+	return opentracing.SpanFromContext(ctx) != nil
+}
+
+func (p *otTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p
+}
+
+func (p *otTracerProvider) Start(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+
+	startOpts := []opentracing.StartSpanOption{otSpanKind(cfg.SpanKind())}
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		startOpts = append(startOpts, opentracing.ChildOf(parent.Context()))
+	}
+	if ts := cfg.Timestamp(); !ts.IsZero() {
+		startOpts = append(startOpts, opentracing.StartTime(ts))
+	}
+
+	sp := p.tracer.StartSpan(spanName, startOpts...)
+	span := &otSpan{span: sp, provider: p}
+	span.SetAttributes(cfg.Attributes()...)
+
+	ctx = opentracing.ContextWithSpan(ctx, sp)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func otSpanKind(kind trace.SpanKind) opentracing.StartSpanOption {
+	switch kind {
+	case trace.SpanKindServer:
+		return ext.SpanKindRPCServer
+	case trace.SpanKindProducer:
+		return ext.SpanKindProducer
+	case trace.SpanKindConsumer:
+		return ext.SpanKindConsumer
+	default:
+		return ext.SpanKindRPCClient
+	}
+}
+
+type otSpan struct {
+	span     opentracing.Span
+	provider *otTracerProvider
+}
+
+func (s *otSpan) End(options ...trace.SpanEndOption) {
+	cfg := trace.NewSpanEndConfig(options...)
+	s.span.FinishWithOptions(opentracing.FinishOptions{FinishTime: cfg.Timestamp()})
+}
+
+func (s *otSpan) AddEvent(name string, options ...trace.EventOption) {
+	cfg := trace.NewEventConfig(options...)
+	s.span.LogFields(append([]otlog.Field{otlog.String("event", name)}, otFields(cfg.Attributes())...)...)
+}
+
+func (s *otSpan) IsRecording() bool {
+	return true
+}
+
+func (s *otSpan) RecordError(err error, options ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+
+	cfg := trace.NewEventConfig(options...)
+	ext.LogError(s.span, err, otFields(cfg.Attributes())...)
+}
+
+// SpanContext is empty, OpenTracing span contexts are opaque.
+func (s *otSpan) SpanContext() trace.SpanContext {
+	return trace.SpanContext{}
+}
+
+func (s *otSpan) SetStatus(code codes.Code, description string) {
+	if code == codes.Error {
+		ext.Error.Set(s.span, true)
+	}
+}
+
+func (s *otSpan) SetName(name string) {
+	s.span.SetOperationName(name)
+}
+
+func (s *otSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.span.SetTag(string(attr.Key), attr.Value.AsInterface())
+	}
+}
+
+func (s *otSpan) TracerProvider() trace.TracerProvider {
+	return s.provider
+}
+
+func otFields(attrs []attribute.KeyValue) []otlog.Field {
+	fields := make([]otlog.Field, 0, len(attrs))
+	for _, attr := range attrs {
+		fields = append(fields, otlog.Object(string(attr.Key), attr.Value.AsInterface()))
+	}
+
+	return fields
+}
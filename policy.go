@@ -0,0 +1,113 @@
+package gorm
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	// _latencyDecay weights the latest statement in the moving average of a replica.
+	_latencyDecay = 0.2
+	// _exploreRatio is the share of reads sent to a random replica by LeastLatency so that
+	// latencies of the others stay fresh.
+	_exploreRatio = 0.1
+)
+
+// ReplicaPolicy picks the replica a read runs on, see WithReplicaPolicy.
+type ReplicaPolicy interface {
+	policy(pools *replicaPools) dbresolver.Policy
+}
+
+type replicaPolicyFunc func(pools *replicaPools) dbresolver.Policy
+
+func (f replicaPolicyFunc) policy(pools *replicaPools) dbresolver.Policy {
+	return f(pools)
+}
+
+// RandomReplica picks a random replica, the dbresolver default.
+func RandomReplica() ReplicaPolicy {
+	return replicaPolicyFunc(func(*replicaPools) dbresolver.Policy {
+		return dbresolver.RandomPolicy{}
+	})
+}
+
+// RoundRobin cycles through the replicas.
+func RoundRobin() ReplicaPolicy {
+	return replicaPolicyFunc(func(*replicaPools) dbresolver.Policy {
+		return &roundRobinPolicy{}
+	})
+}
+
+// LeastLatency picks the replica with the lowest moving average of recent statement
+// durations, 10% of reads go to a random replica to keep measuring the others.
+func LeastLatency() ReplicaPolicy {
+	return replicaPolicyFunc(func(pools *replicaPools) dbresolver.Policy {
+		return &leastLatencyPolicy{pools: pools}
+	})
+}
+
+// CustomReplicaPolicy uses any dbresolver policy.
+func CustomReplicaPolicy(p dbresolver.Policy) ReplicaPolicy {
+	return replicaPolicyFunc(func(*replicaPools) dbresolver.Policy {
+		return p
+	})
+}
+
+// WithReplicaPolicy sets how reads are balanced over the replicas of WithReplicas.
+func WithReplicaPolicy(p ReplicaPolicy) ConnOption {
+	return func(o *connOptions) {
+		o.replicaPolicy = p
+	}
+}
+
+type roundRobinPolicy struct {
+	next uint64
+}
+
+func (p *roundRobinPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	n := atomic.AddUint64(&p.next, 1)
+	return connPools[(n-1)%uint64(len(connPools))]
+}
+
+type leastLatencyPolicy struct {
+	pools *replicaPools
+}
+
+func (p *leastLatencyPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	if rand.Float64() < _exploreRatio {
+		return connPools[rand.Intn(len(connPools))]
+	}
+
+	p.pools.mu.RLock()
+	defer p.pools.mu.RUnlock()
+
+	best, bestLatency := connPools[0], p.pools.latencies[unwrapPool(connPools[0])]
+	for _, pool := range connPools[1:] {
+		// 没有样本的副本延迟为0, 会被优先选中
+		if latency := p.pools.latencies[unwrapPool(pool)]; latency < bestLatency {
+			best, bestLatency = pool, latency
+		}
+	}
+	return best
+}
+
+// observe updates the moving average latency of a replica pool, other pools are ignored.
+func (p *replicaPools) observe(pool gorm.ConnPool, cost time.Duration) {
+	pool = unwrapPool(pool)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.pools[pool]; !ok {
+		return
+	}
+	if prev, ok := p.latencies[pool]; ok {
+		p.latencies[pool] = prev + _latencyDecay*(float64(cost)-prev)
+	} else {
+		p.latencies[pool] = float64(cost)
+	}
+}
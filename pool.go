@@ -0,0 +1,103 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const _poolWaitEvent = "pool.wait"
+
+var (
+	_poolWaitCountKey    = keyWithPrefix("pool.waitCount")
+	_poolWaitDurationKey = keyWithPrefix("pool.waitDurationUs")
+	_poolInUseKey        = keyWithPrefix("pool.inUse")
+	_poolMaxOpenKey      = keyWithPrefix("pool.maxOpen")
+)
+
+func poolStats(db *gorm.DB) (sql.DBStats, bool) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return sql.DBStats{}, false
+	}
+
+	return sqlDB.Stats(), true
+}
+
+// recordPoolWait compares pool stats sampled before and after the statement and adds
+// an event if connections had to be waited for. Stats are shared by the whole pool, so
+// under concurrency waits of other statements may be attributed too.
+func recordPoolWait(db *gorm.DB, span trace.Span) {
+	v, isExist := db.InstanceGet("pool_stats")
+	before, ok := v.(sql.DBStats)
+	if !isExist || !ok {
+		return
+	}
+
+	// 语句结束时的快照, 不含之后的关联语句
+	v, _ = db.InstanceGet("pool_stats_after")
+	after, ok := v.(sql.DBStats)
+	if !ok {
+		if after, ok = poolStats(db); !ok {
+			return
+		}
+	}
+	if after.WaitCount <= before.WaitCount {
+		return
+	}
+
+	span.AddEvent(_poolWaitEvent, trace.WithAttributes(
+		attribute.Int64(_poolWaitCountKey, after.WaitCount-before.WaitCount),
+		attribute.Int64(_poolWaitDurationKey, (after.WaitDuration-before.WaitDuration).Microseconds()),
+		attribute.Int(_poolInUseKey, after.InUse),
+		attribute.Int(_poolMaxOpenKey, after.MaxOpenConnections),
+	))
+}
+
+// poolWaits tracks the last seen wait counters of the pool, so that concurrent statements
+// share the deltas instead of each reporting the same waits.
+type poolWaits struct {
+	mu       sync.Mutex
+	count    int64
+	duration time.Duration
+}
+
+// delta returns waits happened since the previous call.
+func (w *poolWaits) delta(stats sql.DBStats) (int64, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if stats.WaitCount <= w.count {
+		return 0, 0
+	}
+	count, duration := stats.WaitCount-w.count, stats.WaitDuration-w.duration
+	w.count, w.duration = stats.WaitCount, stats.WaitDuration
+	return count, duration
+}
+
+// recordPoolWaitTime adds the waits for connections since the previous statement to the
+// wait time and wait count counters, their ratio is the average wait. DBStats only expose
+// totals, so single waits can't be recorded.
+func (op *OpentracingPlugin) recordPoolWaitTime(ctx context.Context, db *gorm.DB) {
+	stats, ok := poolStats(db)
+	if !ok {
+		return
+	}
+
+	count, duration := op.poolWaits.delta(stats)
+	if count == 0 {
+		return
+	}
+
+	attrs := []attribute.KeyValue{op.dbSystem}
+	if op.opt.connectionName != "" {
+		attrs = append(attrs, _connectionNameKey.String(op.opt.connectionName))
+	}
+	op.metrics.poolWaitTime.Add(ctx, duration.Seconds(), attrs...)
+	op.metrics.poolWaits.Add(ctx, count, attrs...)
+}
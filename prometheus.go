@@ -0,0 +1,87 @@
+package gorm
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const _promNamespace = "gorm"
+
+var _promQueryLabels = []string{"connection", "operation", "table", "status"}
+
+// PrometheusCollector exposes statement counters and durations recorded by plugins created
+// with WithPrometheus, plus pool stats of every connection registered by Get.
+//
+//	c := NewPrometheusCollector()
+//	prometheus.MustRegister(c)
+//	db.Use(New(WithPrometheus(c)))
+type PrometheusCollector struct {
+	queries  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	openConns    *prometheus.Desc
+	inUseConns   *prometheus.Desc
+	idleConns    *prometheus.Desc
+	maxConns     *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+func NewPrometheusCollector() *PrometheusCollector {
+	poolDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(_promNamespace, "connections", name), help, []string{"name"}, nil)
+	}
+
+	return &PrometheusCollector{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: _promNamespace,
+			Name:      "queries_total",
+			Help:      "Total number of executed statements.",
+		}, _promQueryLabels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: _promNamespace,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of executed statements.",
+			Buckets:   prometheus.DefBuckets,
+		}, _promQueryLabels),
+
+		openConns:    poolDesc("open", "Number of established connections."),
+		inUseConns:   poolDesc("in_use", "Number of connections currently in use."),
+		idleConns:    poolDesc("idle", "Number of idle connections."),
+		maxConns:     poolDesc("max", "Maximum number of open connections allowed."),
+		waitCount:    poolDesc("wait_total", "Total number of connections waited for."),
+		waitDuration: poolDesc("wait_seconds_total", "Total time blocked waiting for a new connection."),
+	}
+}
+
+func (c *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.queries.Describe(ch)
+	c.duration.Describe(ch)
+
+	ch <- c.openConns
+	ch <- c.inUseConns
+	ch <- c.idleConns
+	ch <- c.maxConns
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+func (c *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.queries.Collect(ch)
+	c.duration.Collect(ch)
+
+	for name, stats := range registeredDBStats() {
+		ch <- prometheus.MustNewConstMetric(c.openConns, prometheus.GaugeValue, float64(stats.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(c.inUseConns, prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stats.Idle), name)
+		ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stats.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+	}
+}
+
+func (c *PrometheusCollector) observe(connection, operation, table, status string, cost time.Duration) {
+	c.queries.WithLabelValues(connection, operation, table, status).Inc()
+	c.duration.WithLabelValues(connection, operation, table, status).Observe(cost.Seconds())
+}
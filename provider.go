@@ -0,0 +1,95 @@
+package gorm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// DSNProvider returns the current DSN of a connection, e.g. with an AWS IAM auth token or
+// Vault dynamic credentials as password. It is called for every new physical connection
+// and should cache credentials until they are about to expire.
+type DSNProvider func(ctx context.Context) (string, error)
+
+var ErrProviderUnsupported = errors.New("gorm: dsn providers are only supported by the mysql, postgres and sqlite drivers")
+
+// GetWithDSNProvider is GetWithDriver with a DSN resolved by provider each time the pool
+// dials. When provider returns a new DSN, new connections use it while established ones
+// are kept until they expire, so rotation needs no pool rebuild and callers keep their
+// *gorm.DB. Combine with WithConnMaxLifetime to bound how long old credentials live.
+func GetWithDSNProvider(ctx context.Context, name string, driver Driver, provider DSNProvider, opts ...ConnOption) (*gorm.DB, error) {
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+
+	return open(ctx, name, &connection{driver: driver, provider: provider, opts: opts})
+}
+
+// providerConnector dials with the latest DSN of provider, the driver connector is
+// rebuilt only when the DSN changes.
+type providerConnector struct {
+	driver   driver.Driver
+	provider DSNProvider
+
+	mu        sync.Mutex
+	dsn       string
+	connector driver.Connector
+}
+
+func (c *providerConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	connector, err := c.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return connector.Connect(ctx)
+}
+
+func (c *providerConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *providerConnector) current(ctx context.Context) (driver.Connector, error) {
+	dsn, err := c.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connector != nil && dsn == c.dsn {
+		return c.connector, nil
+	}
+
+	connector, err := openConnector(c.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	c.connector, c.dsn = connector, dsn
+	return c.connector, nil
+}
+
+func openConnector(drv driver.Driver, dsn string) (driver.Connector, error) {
+	if dc, ok := drv.(driver.DriverContext); ok {
+		return dc.OpenConnector(dsn)
+	}
+	return dsnConnector{driver: drv, dsn: dsn}, nil
+}
+
+// dsnConnector adapts drivers without driver.DriverContext.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,31 @@
+package gorm
+
+import (
+	"gorm.io/gorm"
+	gormcallbacks "gorm.io/gorm/callbacks"
+)
+
+// _queryStages are the plugins replacing gorm:query, in the order they handle a query.
+var _queryStages = []string{_cachePluginName, _dedupPluginName, _retryPluginName}
+
+// queryStage handles a query or passes it on with next.
+type queryStage interface {
+	queryStage(db *gorm.DB, next func(db *gorm.DB))
+}
+
+// runQuery is the gorm:query callback of the query plugins, so that any of them can be
+// registered together in any order.
+func runQuery(db *gorm.DB) {
+	runQueryFrom(db, 0)
+}
+
+func runQueryFrom(db *gorm.DB, i int) {
+	for ; i < len(_queryStages); i++ {
+		if stage, ok := db.Config.Plugins[_queryStages[i]].(queryStage); ok {
+			next := i + 1
+			stage.queryStage(db, func(db *gorm.DB) { runQueryFrom(db, next) })
+			return
+		}
+	}
+	gormcallbacks.Query(db)
+}
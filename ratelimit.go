@@ -0,0 +1,74 @@
+package gorm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// logLimiter is a token bucket for debug logs, lines over the rate are counted and
+// reported by the next allowed line.
+type logLimiter struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	last       time.Time
+	suppressed int64
+}
+
+func newLogLimiter(perSecond float64, burst int) *logLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &logLimiter{rate: perSecond, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow reports whether a line may be logged at now, and if so how many lines were
+// suppressed since the last allowed one.
+func (l *logLimiter) allow(now time.Time) (bool, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+
+	if l.tokens < 1 {
+		l.suppressed++
+		return false, 0
+	}
+	l.tokens--
+
+	suppressed := l.suppressed
+	l.suppressed = 0
+	return true, suppressed
+}
+
+// statementf writes a per statement line at the level of the operation, through the
+// rate limiter if configured.
+func (op *OpentracingPlugin) statementf(ctx context.Context, name interface{}, format string, args ...interface{}) {
+	level := op.statementLevel(name)
+	if level == LogOff {
+		return
+	}
+
+	if l := op.opt.logLimiter; l != nil {
+		ok, suppressed := l.allow(time.Now())
+		if !ok {
+			return
+		}
+		if suppressed > 0 {
+			op.logf(ctx, level, "[gorm] suppressed %d similar log lines", suppressed)
+		}
+	}
+
+	op.logf(ctx, level, format, args...)
+}
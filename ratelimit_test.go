@@ -0,0 +1,34 @@
+package gorm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogLimiter(t *testing.T) {
+	start := time.Unix(0, 0)
+	type step struct {
+		offset     time.Duration
+		allowed    bool
+		suppressed int64
+	}
+	steps := []step{
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 0},
+		{100 * time.Millisecond, false, 0},
+		{500 * time.Millisecond, true, 2},
+		{500 * time.Millisecond, false, 0},
+		{10 * time.Second, true, 1},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, false, 0},
+	}
+
+	l := newLogLimiter(2, 2)
+	for i, s := range steps {
+		allowed, suppressed := l.allow(start.Add(s.offset))
+		if allowed != s.allowed || suppressed != s.suppressed {
+			t.Errorf("allow step %d, expects %v/%v, but got %v/%v", i, s.allowed, s.suppressed, allowed, suppressed)
+		}
+	}
+}
@@ -0,0 +1,664 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+var (
+	sfg singleflight.Group
+	rwl sync.RWMutex
+
+	dbs = map[string]*connection{}
+
+	ErrNotFound = gorm.ErrRecordNotFound
+)
+
+// connection is a registered connection along with how it was opened.
+type connection struct {
+	// lastUsed and queries are accessed atomically, see evict.go
+	lastUsed int64
+	queries  int64
+
+	db        *gorm.DB
+	driver    Driver
+	dsn       string
+	dialector gorm.Dialector
+	provider  DSNProvider
+	failover  []string
+	tunnel    io.Closer
+	opts      []ConnOption
+	openedAt  time.Time
+
+	// replicaDBs and replicaTunnels belong to the replicas of WithReplicas, they are
+	// closed along with db.
+	replicaDBs     []*sql.DB
+	replicaTunnels []io.Closer
+}
+
+// ConnOption configures a connection when Get opens it, options are ignored once name
+// is registered.
+type ConnOption func(o *connOptions)
+
+type connOptions struct {
+	config  *gorm.Config
+	pool    []func(sqlDB *sql.DB)
+	lazy    bool
+	plugin  []ApplyOption
+	plugins []gorm.Plugin
+
+	tlsConfig     string
+	replicas      []replicaSource
+	replicaPolicy ReplicaPolicy
+	openAttempts  int
+	openBackoff   backoff
+	warmUp        int
+	connectHooks  []ConnectHook
+	sshTunnel     *SSHTunnel
+	err           error
+}
+
+func defaultConnOptions() *connOptions {
+	return &connOptions{config: &gorm.Config{}}
+}
+
+// WithConfig opens the connection with a copy of cfg instead of an empty gorm.Config.
+func WithConfig(cfg *gorm.Config) ConnOption {
+	return func(o *connOptions) {
+		if cfg != nil {
+			c := *cfg
+			o.config = &c
+		}
+	}
+}
+
+// WithConfigFunc mutates the gorm.Config the connection is opened with, e.g. to set
+// PrepareStmt, NamingStrategy, SkipDefaultTransaction or Logger.
+func WithConfigFunc(fn func(cfg *gorm.Config)) ConnOption {
+	return func(o *connOptions) {
+		fn(o.config)
+	}
+}
+
+// WithMaxOpenConns sets sql.DB.SetMaxOpenConns of the connection.
+func WithMaxOpenConns(n int) ConnOption {
+	return func(o *connOptions) {
+		o.pool = append(o.pool, func(sqlDB *sql.DB) { sqlDB.SetMaxOpenConns(n) })
+	}
+}
+
+// WithMaxIdleConns sets sql.DB.SetMaxIdleConns of the connection.
+func WithMaxIdleConns(n int) ConnOption {
+	return func(o *connOptions) {
+		o.pool = append(o.pool, func(sqlDB *sql.DB) { sqlDB.SetMaxIdleConns(n) })
+	}
+}
+
+// WithConnMaxLifetime sets sql.DB.SetConnMaxLifetime of the connection.
+func WithConnMaxLifetime(d time.Duration) ConnOption {
+	return func(o *connOptions) {
+		o.pool = append(o.pool, func(sqlDB *sql.DB) { sqlDB.SetConnMaxLifetime(d) })
+	}
+}
+
+// WithConnMaxIdleTime sets sql.DB.SetConnMaxIdleTime of the connection.
+func WithConnMaxIdleTime(d time.Duration) ConnOption {
+	return func(o *connOptions) {
+		o.pool = append(o.pool, func(sqlDB *sql.DB) { sqlDB.SetConnMaxIdleTime(d) })
+	}
+}
+
+// WithPluginOptions configures the tracing plugin of the connection, the options are
+// applied after the registry defaults WithLogResult(false) and WithSqlParameters(true).
+func WithPluginOptions(opts ...ApplyOption) ConnOption {
+	return func(o *connOptions) {
+		o.plugin = append(o.plugin, opts...)
+	}
+}
+
+// WithPlugins registers additional gorm plugins on the connection after the tracing plugin.
+func WithPlugins(plugins ...gorm.Plugin) ConnOption {
+	return func(o *connOptions) {
+		o.plugins = append(o.plugins, plugins...)
+	}
+}
+
+// WithOpenRetry retries opening the connection up to attempts times, waiting from
+// initial doubling up to max in between, e.g. while DNS isn't ready in Kubernetes.
+// Get gives up when its ctx is done.
+func WithOpenRetry(attempts int, initial, max time.Duration) ConnOption {
+	return func(o *connOptions) {
+		o.openAttempts = attempts
+		o.openBackoff = backoff{initial: initial, max: max}
+	}
+}
+
+// WithLazy opens the connection without connecting: the initial ping and server version
+// query are skipped, so the first statement establishes the first connection. Services
+// with many optional databases no longer pay for, or fail on, those they never use.
+// MySQL and ClickHouse dialectors then assume the latest server features.
+func WithLazy() ConnOption {
+	return func(o *connOptions) {
+		o.lazy = true
+	}
+}
+
+// Get returns the MySQL connection registered as name, opening it with dsn on first use.
+// Opening gives up when ctx is done, bound it with a timeout so an unreachable database
+// doesn't block startup.
+// Open failures are *OpenError matching ErrBadDSN or ErrOpenFailed, they unwrap to the
+// cause, e.g. the driver error, ErrTLSUnsupported or the error of ctx.
+func Get(ctx context.Context, name string, dsn string, opts ...ConnOption) (db *gorm.DB, err error) {
+	return GetWithDriver(ctx, name, DriverMySQL, dsn, opts...)
+}
+
+// GetWithOptions is Get with options of the tracing plugin of this connection, e.g. to
+// log parameters on an analytics database but not on the users one.
+func GetWithOptions(ctx context.Context, name string, dsn string, opts ...ApplyOption) (*gorm.DB, error) {
+	return Get(ctx, name, dsn, WithPluginOptions(opts...))
+}
+
+// MustGet is Get panicking on error, for wiring in main.
+func MustGet(ctx context.Context, name string, dsn string, opts ...ConnOption) *gorm.DB {
+	db, err := Get(ctx, name, dsn, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// GetWithDriver is Get for databases other than MySQL, the driver is only used when
+// name is opened for the first time.
+func GetWithDriver(ctx context.Context, name string, driver Driver, dsn string, opts ...ConnOption) (db *gorm.DB, err error) {
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+
+	return open(ctx, name, &connection{driver: driver, dsn: dsn, opts: opts})
+}
+
+// GetWithDialector registers a connection opened with a caller provided dialector, e.g.
+// for TiDB, Vitess or in-house proxies, and wires the plugin like Get.
+func GetWithDialector(ctx context.Context, name string, d gorm.Dialector, opts ...ConnOption) (db *gorm.DB, err error) {
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+
+	return open(ctx, name, &connection{dialector: d, opts: opts})
+}
+
+// Lookup returns the connection registered as name without opening it, e.g. after it was
+// opened by a helper owning its DSN. Such helpers Pin the name, eviction would otherwise
+// unregister a pool nothing opens again.
+func Lookup(name string) (*gorm.DB, bool) {
+	return registered(name)
+}
+
+func registered(name string) (*gorm.DB, bool) {
+	rwl.RLock()
+	defer rwl.RUnlock()
+
+	if c, ok := dbs[name]; ok {
+		c.touch(time.Now())
+		return c.db, true
+	}
+	return nil, false
+}
+
+func registeredNames() []string {
+	rwl.RLock()
+	defer rwl.RUnlock()
+
+	names := make([]string, 0, len(dbs))
+	for name := range dbs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// open connects c and registers it as name. Concurrent opens of name share the dial of
+// the first caller, which gives up when its ctx is done, every caller stops waiting when
+// its own ctx is done.
+func open(ctx context.Context, name string, c *connection) (*gorm.DB, error) {
+	ch := sfg.DoChan(name, func() (interface{}, error) {
+		// 调用方检查后, 之前的打开可能刚刚完成
+		if db, ok := registered(name); ok {
+			return db, nil
+		}
+		db, err := connectRetry(ctx, name, c)
+		if err != nil {
+			return nil, err
+		}
+		c.db, c.openedAt = db, time.Now()
+		c.touch(c.openedAt)
+
+		rwl.Lock()
+		if prev, ok := dbs[name]; ok {
+			// 打开期间已被注册, 保留已注册的连接
+			rwl.Unlock()
+			_ = c.close()
+			return prev.db, nil
+		}
+		dbs[name] = c
+		event := openedEvent(name)
+		victims := overflow(name)
+		rwl.Unlock()
+
+		emit(event, name, nil)
+		for victim, vc := range victims {
+			go vc.drain()
+			emit(EventEvicted, victim, nil)
+		}
+		return db, nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, openError(name, res.Err)
+		}
+		return res.Val.(*gorm.DB), nil
+	case <-ctx.Done():
+		return nil, openError(name, ctx.Err())
+	}
+}
+
+// openError wraps err in an *OpenError of name unless it already is one.
+func openError(name string, err error) error {
+	var oe *OpenError
+	if errors.As(err, &oe) {
+		return err
+	}
+	return &OpenError{Name: name, Kind: ErrOpenFailed, Err: err}
+}
+
+// options applies the ConnOptions of c to the defaults.
+func (c *connection) options() *connOptions {
+	o := defaultConnOptions()
+	for _, apply := range c.opts {
+		apply(o)
+	}
+	return o
+}
+
+// connectRetry is connect retried as configured by WithOpenRetry while ctx is not done.
+func connectRetry(ctx context.Context, name string, c *connection) (*gorm.DB, error) {
+	o := c.options()
+	for attempt := 1; ; attempt++ {
+		db, err := connect(ctx, name, c, o)
+		if err == nil {
+			if o.warmUp > 0 && !o.lazy {
+				warmUp(ctx, db, o.warmUp)
+			}
+			return db, nil
+		}
+		if attempt >= o.openAttempts || isConfigError(err) {
+			return nil, err
+		}
+		if err := sleep(ctx, o.openBackoff.delay(attempt)); err != nil {
+			return nil, err
+		}
+		// gorm.Open会修改Config, 重试时重新生成
+		o = c.options()
+	}
+}
+
+// isConfigError reports errors retrying can't fix.
+func isConfigError(err error) bool {
+	switch err {
+	case ErrUnknownDriver, ErrTLSUnsupported, ErrReplicasUnsupported, ErrProviderUnsupported, ErrConnectHookUnsupported, ErrFailoverUnsupported, ErrSSHTunnelUnsupported:
+		return true
+	}
+	return errors.Is(err, ErrBadDSN)
+}
+
+// connect opens a pool for c without registering it.
+func connect(ctx context.Context, name string, c *connection, o *connOptions) (db *gorm.DB, err error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+
+	d, dsn := c.dialector, ""
+	if d != nil {
+		switch {
+		case o.tlsConfig != "":
+			return nil, ErrTLSUnsupported
+		case o.sshTunnel != nil:
+			return nil, ErrSSHTunnelUnsupported
+		case len(o.connectHooks) > 0:
+			return nil, ErrConnectHookUnsupported
+		}
+	} else {
+		var tunnel io.Closer
+		if d, dsn, tunnel, err = c.dialect(name, o, c.dsns(), c.provider); err != nil {
+			return nil, err
+		}
+		if tunnel != nil {
+			defer func() {
+				if err != nil {
+					_ = tunnel.Close()
+				} else {
+					c.tunnel = tunnel
+				}
+			}()
+		}
+	}
+	// gorm.Open的ping不带ctx, 改为打开后用ctx ping
+	ping := !o.lazy && !o.config.DisableAutomaticPing
+	o.config.DisableAutomaticPing = true
+
+	db, err = openContext(ctx, d, o.config)
+	if err != nil {
+		return nil, &OpenError{Name: name, Kind: ErrOpenFailed, Err: err}
+	}
+	if ping {
+		if err = pingContext(ctx, db); err != nil {
+			_ = closeDB(db)
+			return nil, &OpenError{Name: name, Kind: ErrOpenFailed, Err: err}
+		}
+	}
+	if err = setup(name, db, c, o, dsn); err != nil {
+		_ = closeDB(db)
+		c.closeReplicas()
+		return nil, &OpenError{Name: name, Kind: ErrOpenFailed, Err: err}
+	}
+	return db, nil
+}
+
+// dialect returns the dialector of a pool of the driver of c dialing dsns, or the DSN of
+// provider, with the TLS config, SSH tunnel and connect hooks of o. The pool is opened
+// for dsn, and tunnel has to be closed along with it.
+func (c *connection) dialect(name string, o *connOptions, dsns []string, provider DSNProvider) (d gorm.Dialector, dsn string, tunnel io.Closer, err error) {
+	if o.tlsConfig != "" {
+		if c.driver != DriverMySQL {
+			return nil, "", nil, ErrTLSUnsupported
+		}
+		if provider != nil {
+			dsnProvider := provider
+			provider = func(ctx context.Context) (string, error) {
+				dsn, err := dsnProvider(ctx)
+				if err != nil {
+					return "", err
+				}
+				return withTLSConfig(dsn, o.tlsConfig)
+			}
+		} else {
+			tlsDSNs := make([]string, len(dsns))
+			for i, dsn := range dsns {
+				if tlsDSNs[i], err = withTLSConfig(dsn, o.tlsConfig); err != nil {
+					return nil, "", nil, err
+				}
+			}
+			dsns = tlsDSNs
+		}
+	}
+	if o.sshTunnel != nil {
+		if provider != nil || len(dsns) > 1 || c.driver != DriverMySQL {
+			return nil, "", nil, ErrSSHTunnelUnsupported
+		}
+		var (
+			t         *sshTunnel
+			tunnelDSN string
+		)
+		if t, tunnelDSN, err = openSSHTunnel(*o.sshTunnel, dsns[0]); err != nil {
+			return nil, "", nil, &OpenError{Name: name, Kind: ErrOpenFailed, Err: err}
+		}
+		defer func() {
+			if err != nil {
+				_ = t.Close()
+			}
+		}()
+		dsns, tunnel = []string{tunnelDSN}, t
+	}
+	if len(dsns) > 0 {
+		dsn = dsns[0]
+	}
+
+	if provider == nil {
+		for _, dsn := range dsns {
+			if err = c.driver.validateDSN(dsn); err != nil {
+				return nil, "", nil, &OpenError{Name: name, Kind: ErrBadDSN, Err: err}
+			}
+		}
+	}
+	if provider != nil || len(dsns) > 1 || len(o.connectHooks) > 0 {
+		d, err = c.driver.connectorDialector(name, dsns, provider, o.connectHooks, o.lazy)
+	} else {
+		d, err = c.driver.dialector(dsn, o.lazy)
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return d, dsn, tunnel, nil
+}
+
+// openContext is gorm.Open giving up when ctx is done, e.g. while the dialector queries
+// the server version. An abandoned pool is closed once gorm.Open returns.
+func openContext(ctx context.Context, d gorm.Dialector, cfg *gorm.Config) (*gorm.DB, error) {
+	type result struct {
+		db  *gorm.DB
+		err error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		db, err := gorm.Open(d, cfg)
+		ch <- result{db: db, err: err}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.db, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-ch; res.err == nil {
+				_ = closeDB(res.db)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func pingContext(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+// setup configures the pool and registers plugins on a freshly opened connection.
+func setup(name string, db *gorm.DB, c *connection, o *connOptions, dsn string) error {
+	if err := c.driver.configure(db, dsn); err != nil {
+		return err
+	}
+	if len(o.pool) > 0 {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		for _, apply := range o.pool {
+			apply(sqlDB)
+		}
+	}
+
+	pluginOpts := []ApplyOption{WithLogResult(false), WithSqlParameters(true), WithConnectionName(name)}
+	if len(o.replicas) > 0 {
+		pools, err := useReplicas(name, db, c, o)
+		if err != nil {
+			return err
+		}
+		pluginOpts = append(pluginOpts, withReplicaPools(pools))
+	}
+	pluginOpts = append(pluginOpts, o.plugin...)
+	if err := db.Use(New(pluginOpts...)); err != nil {
+		return err
+	}
+
+	for _, plugin := range o.plugins {
+		if err := db.Use(plugin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes name from the registry and closes its pool, Get opens it again afterwards.
+// It waits up to 30s until every Acquire of name is released, statements still running on
+// a previously returned *gorm.DB that wasn't acquired fail once the pool is closed.
+func Close(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), _maxDrain)
+	defer cancel()
+
+	return closeContext(ctx, name)
+}
+
+// closeContext is Close waiting for Release until ctx is done.
+func closeContext(ctx context.Context, name string) error {
+	rwl.Lock()
+	c, ok := dbs[name]
+	delete(dbs, name)
+	rwl.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	emit(EventClosed, name, nil)
+	_ = c.waitReleased(ctx)
+	return c.close()
+}
+
+// CloseAll closes every registered connection, waiting for Release until ctx is done. If
+// ctx is done it closes the connection it waits for and stops early, the connections not
+// closed yet stay registered.
+func CloseAll(ctx context.Context) error {
+	var errs []string
+	for _, name := range registeredNames() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := closeContext(ctx, name); err != nil {
+			errs = append(errs, name+": "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// close closes the pool of c and what it depends on, e.g. its replicas and SSH tunnel.
+func (c *connection) close() error {
+	err := closeDB(c.db)
+	c.closeReplicas()
+	if c.tunnel != nil {
+		_ = c.tunnel.Close()
+	}
+	return err
+}
+
+// closeReplicas closes the pools and tunnels of the replicas of c.
+func (c *connection) closeReplicas() {
+	for _, sqlDB := range c.replicaDBs {
+		_ = sqlDB.Close()
+	}
+	for _, tunnel := range c.replicaTunnels {
+		_ = tunnel.Close()
+	}
+	c.replicaDBs, c.replicaTunnels = nil, nil
+}
+
+// drain is close once the pool is released and no connection is in use, waiting 30s at
+// most for each.
+func (c *connection) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), _maxDrain)
+	_ = c.waitReleased(ctx)
+	cancel()
+	if sqlDB, err := c.db.DB(); err == nil {
+		drain(sqlDB)
+	}
+	for _, sqlDB := range c.replicaDBs {
+		drain(sqlDB)
+	}
+	c.closeReplicas()
+	if c.tunnel != nil {
+		_ = c.tunnel.Close()
+	}
+}
+
+func closeDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+// _maxDrain bounds how long Replace waits for statements on the old pool.
+const _maxDrain = 30 * time.Second
+
+var ErrNotReplaceable = errors.New("gorm: connection opened with a custom dialector, dsn provider or failover dsns can't be replaced by DSN")
+
+// Replace opens a new pool for name with newDSN, keeping the driver and options it was
+// registered with, and swaps it into the registry once it answers a ping. The old pool is
+// closed in the background when it has no connection in use, or after 30s. Failures to
+// open the new pool are *OpenError like those of Get.
+func Replace(ctx context.Context, name string, newDSN string) (*gorm.DB, error) {
+	rwl.RLock()
+	old, ok := dbs[name]
+	rwl.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if old.dialector != nil || old.provider != nil || len(old.failover) > 0 {
+		return nil, ErrNotReplaceable
+	}
+
+	c := &connection{driver: old.driver, dsn: newDSN, opts: old.opts}
+	db, err := connectRetry(ctx, name, c)
+	if err != nil {
+		return nil, openError(name, err)
+	}
+	// 切换前确认新连接可用, 否则保留旧连接
+	if err = ping(ctx, db); err != nil {
+		c.db = db
+		_ = c.close()
+		return nil, openError(name, err)
+	}
+	c.db, c.openedAt = db, time.Now()
+	c.touch(c.openedAt)
+
+	rwl.Lock()
+	prev := dbs[name]
+	dbs[name] = c
+	opened[name] = struct{}{}
+	rwl.Unlock()
+
+	emit(EventReopened, name, nil)
+
+	if prev != nil {
+		go prev.drain()
+	}
+	return db, nil
+}
+
+// drain closes sqlDB once no connection is in use.
+func drain(sqlDB *sql.DB) {
+	deadline := time.Now().Add(_maxDrain)
+	for sqlDB.Stats().InUse > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	_ = sqlDB.Close()
+}
@@ -0,0 +1,149 @@
+package gorm
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	_dbRoleKey = attribute.Key("db.role")
+
+	_rolePrimary = "primary"
+	_roleReplica = "replica"
+)
+
+var ErrReplicasUnsupported = errors.New("gorm: replicas need a driver, not a custom dialector")
+
+// WithReplicas routes reads of the connection to replicas opened with the same driver
+// and options, e.g. pool, TLS, SSH tunnel and session options, through
+// gorm.io/plugin/dbresolver. Spans are tagged with db.role.
+func WithReplicas(dsns ...string) ConnOption {
+	return func(o *connOptions) {
+		for _, dsn := range dsns {
+			o.replicas = append(o.replicas, replicaSource{dsn: dsn})
+		}
+	}
+}
+
+// WithReplicaProviders is WithReplicas with the DSN of each replica resolved by a
+// DSNProvider when it dials, e.g. RDSIAMProvider of a read replica.
+func WithReplicaProviders(providers ...DSNProvider) ConnOption {
+	return func(o *connOptions) {
+		for _, provider := range providers {
+			o.replicas = append(o.replicas, replicaSource{provider: provider})
+		}
+	}
+}
+
+// replicaSource is the DSN of a replica, or its provider.
+type replicaSource struct {
+	dsn      string
+	provider DSNProvider
+}
+
+// replicaPools records the connection pools dbresolver opens for replicas, so that
+// the pool a statement ran on tells its role.
+type replicaPools struct {
+	mu        sync.RWMutex
+	pools     map[gorm.ConnPool]struct{}
+	latencies map[gorm.ConnPool]float64
+}
+
+func (p *replicaPools) add(pool gorm.ConnPool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pools[pool] = struct{}{}
+}
+
+func (p *replicaPools) role(pool gorm.ConnPool) attribute.KeyValue {
+	pool = unwrapPool(pool)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if _, ok := p.pools[pool]; ok {
+		return _dbRoleKey.String(_roleReplica)
+	}
+	// 事务及写操作都在主库上
+	return _dbRoleKey.String(_rolePrimary)
+}
+
+// replicaDialector reports the pool of the replica once dbresolver initializes it, and
+// keeps it on the connection so that it is closed along with the primary.
+type replicaDialector struct {
+	gorm.Dialector
+	conn  *connection
+	pools *replicaPools
+	pool  []func(sqlDB *sql.DB)
+}
+
+func (d replicaDialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+
+	if sqlDB, ok := db.ConnPool.(*sql.DB); ok {
+		d.conn.replicaDBs = append(d.conn.replicaDBs, sqlDB)
+		for _, apply := range d.pool {
+			apply(sqlDB)
+		}
+	}
+	d.pools.add(unwrapPool(db.ConnPool))
+	return nil
+}
+
+func unwrapPool(pool gorm.ConnPool) gorm.ConnPool {
+	if stmtDB, ok := pool.(*gorm.PreparedStmtDB); ok {
+		return stmtDB.ConnPool
+	}
+	return pool
+}
+
+// useReplicas registers dbresolver with the replicas of o, dialed like the primary of c.
+func useReplicas(name string, db *gorm.DB, c *connection, o *connOptions) (*replicaPools, error) {
+	if c.dialector != nil {
+		return nil, ErrReplicasUnsupported
+	}
+
+	pools := &replicaPools{
+		pools:     make(map[gorm.ConnPool]struct{}, len(o.replicas)),
+		latencies: make(map[gorm.ConnPool]float64, len(o.replicas)),
+	}
+	replicas := make([]gorm.Dialector, 0, len(o.replicas))
+	for _, r := range o.replicas {
+		var dsns []string
+		if r.provider == nil {
+			dsns = []string{r.dsn}
+		}
+		d, _, tunnel, err := c.dialect(name, o, dsns, r.provider)
+		if err != nil {
+			return nil, err
+		}
+		if tunnel != nil {
+			c.replicaTunnels = append(c.replicaTunnels, tunnel)
+		}
+		replicas = append(replicas, replicaDialector{Dialector: d, conn: c, pools: pools, pool: o.pool})
+	}
+
+	cfg := dbresolver.Config{Replicas: replicas}
+	if o.replicaPolicy != nil {
+		cfg.Policy = o.replicaPolicy.policy(pools)
+	}
+	if err := db.Use(dbresolver.Register(cfg)); err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
+
+// withReplicaPools tags spans with db.role of the pool the statement ran on.
+func withReplicaPools(pools *replicaPools) ApplyOption {
+	return func(o *options) {
+		o.replicaPools = pools
+	}
+}
@@ -0,0 +1,54 @@
+package gorm
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+const (
+	_resultEvent = "result"
+
+	_defaultResultMaxRows  = 10
+	_defaultResultMaxBytes = 4096
+)
+
+var _resultRowsKey = keyWithPrefix("result.rows")
+
+// resultRows returns the number of rows scanned into the statement destination.
+func resultRows(stmt *gorm.Statement) int {
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		return stmt.ReflectValue.Len()
+	case reflect.Invalid:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// encodeResult serializes at most maxRows rows of the statement destination as JSON,
+// truncated to maxBytes.
+func encodeResult(stmt *gorm.Statement, maxRows, maxBytes int) (string, bool) {
+	if stmt.Dest == nil || !stmt.ReflectValue.IsValid() {
+		return "", false
+	}
+
+	value := stmt.Dest
+	if kind := stmt.ReflectValue.Kind(); (kind == reflect.Slice || kind == reflect.Array) && stmt.ReflectValue.Len() > maxRows {
+		value = stmt.ReflectValue.Slice(0, maxRows).Interface()
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+
+	result := string(b)
+	if len(result) > maxBytes {
+		result = truncate(result, maxBytes)
+	}
+
+	return result, true
+}
@@ -0,0 +1,77 @@
+package gorm
+
+import (
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	_retryPluginName = "otel:retry"
+	_retryEvent      = "db.retry"
+)
+
+var _retryAttemptKey = attribute.Key("db.retry.attempt")
+
+// QueryRetry is a gorm plugin retrying queries failing with transient errors: deadlocks,
+// lock wait timeouts and broken connections. Only queries are retried, they are the
+// idempotent operations, and not in transactions, which the error aborted; see
+// RetryTransaction for those. Each failed attempt adds a db.retry event to the span.
+type QueryRetry struct {
+	attempts int
+	backoff  backoff
+}
+
+// NewQueryRetry retries up to attempts times in total, waiting from initial doubling up
+// to max in between, register it with db.Use.
+func NewQueryRetry(attempts int, initial, max time.Duration) *QueryRetry {
+	return &QueryRetry{attempts: attempts, backoff: backoff{initial: initial, max: max}}
+}
+
+func (r *QueryRetry) Name() string {
+	return _retryPluginName
+}
+
+func (r *QueryRetry) Initialize(db *gorm.DB) error {
+	return db.Callback().Query().Replace("gorm:query", runQuery)
+}
+
+func (r *QueryRetry) queryStage(db *gorm.DB, next func(db *gorm.DB)) {
+	if db.Error != nil || db.DryRun {
+		next(db)
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		next(db)
+		return
+	}
+
+	ctx := db.Statement.Context
+	for attempt := 1; ; attempt++ {
+		next(db)
+		if db.Error == nil || attempt >= r.attempts || !isTransient(db.Error) {
+			return
+		}
+
+		trace.SpanFromContext(ctx).AddEvent(_retryEvent, trace.WithAttributes(
+			_retryAttemptKey.Int(attempt),
+			_errorTypeKey.String(classifyError(db.Error)),
+		))
+		if err := sleep(ctx, r.backoff.delay(attempt)); err != nil {
+			return
+		}
+		// 重试前清除上次的错误和结果
+		db.Error, db.RowsAffected = nil, 0
+	}
+}
+
+// isTransient reports errors a retry may not hit again.
+func isTransient(err error) bool {
+	switch classifyError(err) {
+	case ErrClassDeadlock, ErrClassLockWaitTimeout, ErrClassBadConnection:
+		return true
+	}
+	return false
+}
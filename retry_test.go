@@ -0,0 +1,27 @@
+package gorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+func TestIsTransient(t *testing.T) {
+	testSuites := map[error]bool{
+		&gomysql.MySQLError{Number: 1213}:                      true,
+		&gomysql.MySQLError{Number: 1205}:                      true,
+		fmt.Errorf("query: %w", driver.ErrBadConn):             true,
+		gomysql.ErrInvalidConn:                                 true,
+		&gomysql.MySQLError{Number: 1062}:                      false,
+		errors.New("Error 1213: Deadlock found (not wrapped)"): false,
+	}
+
+	for err, expected := range testSuites {
+		if got := isTransient(err); got != expected {
+			t.Errorf("isTransient %v, expects %v, but got %v", err, expected, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package gorm
+
+import (
+	"strings"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SemconvVersion selects which OpenTelemetry database semantic conventions spans follow.
+type SemconvVersion string
+
+const (
+	// SemconvLegacy emits db.name / db.statement, the default.
+	SemconvLegacy SemconvVersion = "legacy"
+	// Semconv1_26 emits db.namespace / db.query.text introduced by semconv v1.26.0.
+	Semconv1_26 SemconvVersion = "1.26"
+)
+
+type semconvKeys struct {
+	dbName      attribute.Key
+	dbStatement attribute.Key
+	dbOperation attribute.Key
+	dbTable     attribute.Key
+}
+
+var _semconvKeys = map[SemconvVersion]semconvKeys{
+	SemconvLegacy: {
+		dbName:      util.DBNameKey,
+		dbStatement: util.DBStatementKey,
+		dbOperation: attribute.Key("db.operation"),
+		dbTable:     attribute.Key("db.sql.table"),
+	},
+	Semconv1_26: {
+		dbName:      attribute.Key("db.namespace"),
+		dbStatement: attribute.Key("db.query.text"),
+		dbOperation: attribute.Key("db.operation.name"),
+		dbTable:     attribute.Key("db.collection.name"),
+	},
+}
+
+const _dbSystemKey = attribute.Key("db.system")
+
+// dbSystemOf maps gorm dialector names to db.system values.
+func dbSystemOf(dialector string) attribute.KeyValue {
+	switch dialector {
+	case "mysql":
+		return util.DBSystemValue
+	case "postgres":
+		return _dbSystemKey.String("postgresql")
+	case "sqlite":
+		return _dbSystemKey.String("sqlite")
+	case "sqlserver":
+		return _dbSystemKey.String("mssql")
+	case "clickhouse":
+		return _dbSystemKey.String("clickhouse")
+	default:
+		return _dbSystemKey.String("other_sql")
+	}
+}
+
+// sqlOperation returns the leading keyword of sql (SELECT, INSERT, ...), skipping comments.
+func sqlOperation(sql string) string {
+	sql = strings.TrimSpace(sql)
+	for strings.HasPrefix(sql, "/*") {
+		end := strings.Index(sql, "*/")
+		if end < 0 {
+			return ""
+		}
+		sql = strings.TrimSpace(sql[end+2:])
+	}
+
+	if i := strings.IndexFunc(sql, unicode.IsSpace); i > 0 {
+		sql = sql[:i]
+	}
+
+	return strings.ToUpper(sql)
+}
@@ -0,0 +1,18 @@
+package gorm
+
+import "testing"
+
+func TestSQLOperation(t *testing.T) {
+	for sql, expected := range map[string]string{
+		"SELECT * FROM `users` WHERE `users`.`id` = ?":                                                          "SELECT",
+		"  insert INTO `users` (`name`) VALUES (?)":                                                             "INSERT",
+		"/*traceparent='00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01'*/ UPDATE `users` SET `name`=?": "UPDATE",
+		"/* a */ /* b */\nDELETE FROM `users`":                                                                  "DELETE",
+		"/* unterminated":                                                                                       "",
+		"":                                                                                                      "",
+	} {
+		if result := sqlOperation(sql); result != expected {
+			t.Errorf("operation of %v, expects %v, but got %v", sql, expected, result)
+		}
+	}
+}
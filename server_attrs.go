@@ -0,0 +1,95 @@
+package gorm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/driver/clickhouse"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	_serverAddressKey    = attribute.Key("server.address")
+	_serverPortKey       = attribute.Key("server.port")
+	_networkTransportKey = attribute.Key("network.transport")
+)
+
+// serverAttributes resolves the database endpoint from the dialector DSN,
+// returns nil if it is unknown.
+func serverAttributes(d gorm.Dialector) []attribute.KeyValue {
+	switch d := d.(type) {
+	case *mysql.Dialector:
+		if d.Config == nil || d.DSN == "" {
+			return nil
+		}
+		cfg, err := gomysql.ParseDSN(d.DSN)
+		if err != nil {
+			return nil
+		}
+		return netAttributes(cfg.Net, cfg.Addr)
+	case *postgres.Dialector:
+		if d.Config == nil || d.DSN == "" {
+			return nil
+		}
+		cfg, err := pgconn.ParseConfig(d.DSN)
+		if err != nil {
+			return nil
+		}
+		// host以/开头时为unix socket目录
+		if strings.HasPrefix(cfg.Host, "/") {
+			return netAttributes("unix", cfg.Host)
+		}
+		return netAttributes("tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))))
+	case *clickhouse.Dialector:
+		if d.Config == nil || d.DSN == "" {
+			return nil
+		}
+		addr, err := clickhouseAddr(d.DSN)
+		if err != nil {
+			return nil
+		}
+		return netAttributes("tcp", addr)
+	}
+
+	return nil
+}
+
+// clickhouseAddr returns the host of a clickhouse-go v1 DSN such as
+// tcp://127.0.0.1:9000?database=events&alt_hosts=127.0.0.2:9000.
+func clickhouseAddr(dsn string) (string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	// alt_hosts里的备用地址不记录
+	if u.Host == "" {
+		return "", errors.New("clickhouse: missing host in dsn")
+	}
+	return u.Host, nil
+}
+
+func netAttributes(network, addr string) []attribute.KeyValue {
+	if network == "unix" {
+		return []attribute.KeyValue{_serverAddressKey.String(addr), _networkTransportKey.String("unix")}
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []attribute.KeyValue{_serverAddressKey.String(addr), _networkTransportKey.String("tcp")}
+	}
+
+	attrs := []attribute.KeyValue{_serverAddressKey.String(host), _networkTransportKey.String("tcp")}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, _serverPortKey.Int(p))
+	}
+
+	return attrs
+}
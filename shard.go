@@ -0,0 +1,121 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const (
+	_dbShardKey = attribute.Key("db.shard")
+
+	// _shardVirtualNodes 每个分片在环上的虚拟节点数, 使键分布均匀
+	_shardVirtualNodes = 128
+)
+
+var (
+	ErrUnknownCluster    = errors.New("gorm: unknown cluster")
+	ErrClusterRegistered = errors.New("gorm: shard cluster already registered")
+	ErrNoShards          = errors.New("gorm: shard cluster needs at least one dsn")
+)
+
+// shardCluster is a registered shard cluster, shards are opened on first use.
+type shardCluster struct {
+	driver Driver
+	dsns   []string
+	opts   []ConnOption
+	ring   *hashRing
+}
+
+// clusters are the registered shard clusters, guarded by rwl.
+var clusters = map[string]*shardCluster{}
+
+// RegisterShards registers cluster as the DSNs of its shards, each shard gets its own
+// pool registered as "<cluster>/<index>" and opened with opts on first use. Keys are
+// mapped to shards by consistent hashing, so appending a DSN only moves about 1/N of the
+// keys. Spans of a shard are tagged with db.shard set to its index.
+func RegisterShards(cluster string, driver Driver, dsns []string, opts ...ConnOption) error {
+	if len(dsns) == 0 {
+		return ErrNoShards
+	}
+	if !driver.known() {
+		return ErrUnknownDriver
+	}
+
+	rwl.Lock()
+	defer rwl.Unlock()
+
+	if _, ok := clusters[cluster]; ok {
+		return ErrClusterRegistered
+	}
+	clusters[cluster] = &shardCluster{
+		driver: driver,
+		dsns:   append([]string(nil), dsns...),
+		opts:   opts,
+		ring:   newHashRing(len(dsns), _shardVirtualNodes),
+	}
+	return nil
+}
+
+// GetShard returns the pool of the shard of cluster owning shardKey, e.g. a user ID or a
+// region, opening it on first use like Get.
+func GetShard(ctx context.Context, cluster string, shardKey string) (*gorm.DB, error) {
+	rwl.RLock()
+	sc, ok := clusters[cluster]
+	rwl.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCluster
+	}
+
+	idx := sc.ring.get(shardKey)
+	shard := strconv.Itoa(idx)
+	name := cluster + "/" + shard
+	if db, ok := registered(name); ok {
+		return db, nil
+	}
+
+	opts := make([]ConnOption, 0, len(sc.opts)+1)
+	opts = append(opts, sc.opts...)
+	opts = append(opts, WithPluginOptions(WithAttributes(_dbShardKey.String(shard))))
+	return open(ctx, name, &connection{driver: sc.driver, dsn: sc.dsns[idx], opts: opts})
+}
+
+// hashRing maps keys to n shards with consistent hashing.
+type hashRing struct {
+	hashes []uint32
+	shards map[uint32]int
+}
+
+func newHashRing(n, virtualNodes int) *hashRing {
+	r := &hashRing{
+		hashes: make([]uint32, 0, n*virtualNodes),
+		shards: make(map[uint32]int, n*virtualNodes),
+	}
+	for shard := 0; shard < n; shard++ {
+		for v := 0; v < virtualNodes; v++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(shard) + "#" + strconv.Itoa(v)))
+			if _, ok := r.shards[h]; ok {
+				continue
+			}
+			r.shards[h] = shard
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// get returns the shard of the first virtual node clockwise from the hash of key.
+func (r *hashRing) get(key string) int {
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.shards[r.hashes[i]]
+}
@@ -0,0 +1,34 @@
+package gorm
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashRingStable(t *testing.T) {
+	before, after := newHashRing(4, _shardVirtualNodes), newHashRing(5, _shardVirtualNodes)
+
+	moved, counts := 0, make([]int, 4)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		shard := before.get(key)
+		if got := before.get(key); got != shard {
+			t.Errorf("get %v, expects %v, but got %v", key, shard, got)
+		}
+		counts[shard]++
+		if got := after.get(key); got != shard && got != 4 {
+			t.Errorf("get %v after adding a shard, expects %v or 4, but got %v", key, shard, got)
+		} else if got == 4 {
+			moved++
+		}
+	}
+
+	for shard, count := range counts {
+		if count < 1500 || count > 3500 {
+			t.Errorf("shard %v, expects about 2500 keys, but got %v", shard, count)
+		}
+	}
+	if moved < 1000 || moved > 3000 {
+		t.Errorf("moved keys, expects about 2000, but got %v", moved)
+	}
+}
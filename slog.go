@@ -0,0 +1,119 @@
+//go:build go1.21
+// +build go1.21
+
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SlogLogger writes both the plugin's logs (WithLogger) and gorm's own logs (gorm.Config.Logger)
+// to a slog.Logger, statements are logged with sql, duration, rows and trace_id fields.
+//
+//	l := NewSlogLogger(slog.Default(), 200*time.Millisecond)
+//	db, err := gorm.Open(dialector, &gorm.Config{Logger: l})
+//	db.Use(New(WithLogger(l)))
+type SlogLogger struct {
+	l             *slog.Logger
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+// NewSlogLogger logs statements slower than slowThreshold at WARN, zero disables it.
+func NewSlogLogger(l *slog.Logger, slowThreshold time.Duration) *SlogLogger {
+	return &SlogLogger{l: l, level: logger.Warn, slowThreshold: slowThreshold}
+}
+
+func (s *SlogLogger) Debugf(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelDebug, format, args...)
+}
+
+func (s *SlogLogger) Infof(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelInfo, format, args...)
+}
+
+func (s *SlogLogger) Warnf(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelWarn, format, args...)
+}
+
+func (s *SlogLogger) Errorf(ctx context.Context, format string, args ...interface{}) {
+	s.logf(ctx, slog.LevelError, format, args...)
+}
+
+func (s *SlogLogger) LogMode(level logger.LogLevel) logger.Interface {
+	c := *s
+	c.level = level
+	return &c
+}
+
+func (s *SlogLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if s.level >= logger.Info {
+		s.logf(ctx, slog.LevelInfo, msg, data...)
+	}
+}
+
+func (s *SlogLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if s.level >= logger.Warn {
+		s.logf(ctx, slog.LevelWarn, msg, data...)
+	}
+}
+
+func (s *SlogLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if s.level >= logger.Error {
+		s.logf(ctx, slog.LevelError, msg, data...)
+	}
+}
+
+func (s *SlogLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if s.level <= logger.Silent {
+		return
+	}
+
+	cost := time.Since(begin)
+	level, msg := slog.LevelDebug, "[gorm] query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && s.level >= logger.Error:
+		level, msg = slog.LevelError, "[gorm] query failed"
+	case s.slowThreshold > 0 && cost > s.slowThreshold && s.level >= logger.Warn:
+		level, msg = slog.LevelWarn, "[gorm] slow query"
+	case s.level < logger.Info:
+		return
+	}
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := append(s.traceAttrs(ctx),
+		slog.String("sql", sql),
+		slog.Duration("duration", cost),
+		slog.Int64("rows", rows),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	s.l.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (s *SlogLogger) logf(ctx context.Context, level slog.Level, format string, args ...interface{}) {
+	if !s.l.Enabled(ctx, level) {
+		return
+	}
+	s.l.LogAttrs(ctx, level, fmt.Sprintf(format, args...), s.traceAttrs(ctx)...)
+}
+
+func (s *SlogLogger) traceAttrs(ctx context.Context) []slog.Attr {
+	traceID, spanID, ok := spanIDs(ctx)
+	if !ok {
+		return nil
+	}
+
+	return []slog.Attr{slog.String(_traceIDField, traceID), slog.String(_spanIDField, spanID)}
+}
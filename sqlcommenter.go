@@ -0,0 +1,88 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// _sqlCommentInstance 记录注入的注释, 记录语句时去掉
+const _sqlCommentInstance = "sql_comment"
+
+// ErrSqlCommenterPrepareStmt is returned registering WithSqlCommenter on a db with
+// PrepareStmt: every comment is different, so each statement would be prepared and cached anew.
+var ErrSqlCommenterPrepareStmt = errors.New("gorm: sqlcommenter can't be used with PrepareStmt, every commented statement would be prepared and kept")
+
+// preparedStmt reports whether statements on pool are prepared and cached by gorm, e.g. in
+// a session with PrepareStmt, they are not commented.
+func preparedStmt(pool gorm.ConnPool) bool {
+	switch pool.(type) {
+	case *gorm.PreparedStmtDB, *gorm.PreparedStmtTX:
+		return true
+	}
+	return false
+}
+
+// sqlComment formats the trace context of ctx following https://google.github.io/sqlcommenter/spec/
+func sqlComment(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return ""
+	}
+
+	keys := carrier.Keys()
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.ReplaceAll(url.QueryEscape(carrier.Get(key)), "'", `\'`)
+		pairs = append(pairs, key+"='"+value+"'")
+	}
+
+	return "/*" + strings.Join(pairs, ",") + "*/"
+}
+
+// injectSQLComment prepends comment to the statement, raw SQL is rewritten directly,
+// otherwise the comment is attached to the leading clause (SELECT, INSERT, ...) before it is built.
+func injectSQLComment(stmt *gorm.Statement, comment string) {
+	if comment == "" {
+		return
+	}
+
+	if stmt.SQL.Len() > 0 {
+		sql := stmt.SQL.String()
+		stmt.SQL.Reset()
+		stmt.SQL.WriteString(comment)
+		stmt.SQL.WriteByte(' ')
+		stmt.SQL.WriteString(sql)
+		return
+	}
+
+	if len(stmt.BuildClauses) == 0 || stmt.Clauses == nil {
+		return
+	}
+
+	name := stmt.BuildClauses[0]
+	c := stmt.Clauses[name]
+	c.Name = name
+	c.BeforeExpression = clause.Expr{SQL: comment}
+	stmt.Clauses[name] = c
+}
+
+// statementSQL returns the SQL of the statement without the comment injected by
+// WithSqlCommenter, so that recorded statements of different traces stay identical.
+func statementSQL(db *gorm.DB) string {
+	sql := db.Statement.SQL.String()
+	v, _ := db.InstanceGet(_sqlCommentInstance)
+	if comment, ok := v.(string); ok && comment != "" {
+		sql = strings.TrimPrefix(sql, comment+" ")
+	}
+	return sql
+}
@@ -0,0 +1,40 @@
+package gorm
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSqlCommenterPrepareStmt(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:commenter_prepared?mode=memory&cache=shared"), &gorm.Config{PrepareStmt: true})
+	if err != nil {
+		t.Fatalf("gorm.Open, expects no error, but got %v", err)
+	}
+	if err = db.Use(New(WithTracer(&idTracer{}), WithSqlCommenter(true))); !errors.Is(err, ErrSqlCommenterPrepareStmt) {
+		t.Errorf("Use with PrepareStmt, expects %v, but got %v", ErrSqlCommenterPrepareStmt, err)
+	}
+
+	db, err = gorm.Open(sqlite.Open("file:commenter?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open, expects no error, but got %v", err)
+	}
+	if err = db.Use(New(WithTracer(&idTracer{}), WithSqlCommenter(true))); err != nil {
+		t.Fatalf("Use, expects no error, but got %v", err)
+	}
+
+	// 每条语句的注释不同, 预编译会话里不注入, 否则每次都缓存一条新语句
+	session := db.Session(&gorm.Session{PrepareStmt: true})
+	for i := 0; i < 3; i++ {
+		var n int
+		if err = session.Raw("SELECT 1").Scan(&n).Error; err != nil {
+			t.Fatalf("Raw, expects no error, but got %v", err)
+		}
+	}
+	stmts := session.Statement.ConnPool.(*gorm.PreparedStmtDB).Stmts
+	if len(stmts) != 1 {
+		t.Errorf("prepared statements, expects %v, but got %v", 1, len(stmts))
+	}
+}
@@ -0,0 +1,179 @@
+package gorm
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	_sshDialTimeout       = 10 * time.Second
+	_sshKeepAliveInterval = 30 * time.Second
+)
+
+var ErrSSHTunnelUnsupported = errors.New("gorm: ssh tunnels are only supported by mysql connections with a single dsn")
+
+// SSHTunnel is a jump host connections are forwarded through, e.g. a bastion in front
+// of a staging database.
+type SSHTunnel struct {
+	// Addr is host:port of the SSH server.
+	Addr            string
+	User            string
+	Auth            []ssh.AuthMethod
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// WithSSHTunnel forwards the connection through an SSH jump host: the registry listens on
+// a local port, points the DSN at it and forwards every connection of the pool to the
+// database address through the tunnel. A dropped tunnel is re-established by the next
+// connection the pool dials, the tunnel is closed with the pool.
+func WithSSHTunnel(tunnel SSHTunnel) ConnOption {
+	return func(o *connOptions) {
+		o.sshTunnel = &tunnel
+	}
+}
+
+// sshTunnel forwards connections accepted on a local port to remote through SSH.
+type sshTunnel struct {
+	cfg      SSHTunnel
+	remote   string
+	listener net.Listener
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// openSSHTunnel connects to the jump host and returns dsn pointed at the local port.
+func openSSHTunnel(cfg SSHTunnel, dsn string) (*sshTunnel, string, error) {
+	mysqlCfg, err := gomysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", err
+	}
+	t := &sshTunnel{cfg: cfg, remote: mysqlCfg.Addr, listener: listener}
+	// 先建立一次SSH连接, 配置错误在打开时就暴露
+	if _, err = t.sshClient(); err != nil {
+		_ = listener.Close()
+		return nil, "", err
+	}
+	go t.serve()
+
+	mysqlCfg.Net, mysqlCfg.Addr = "tcp", listener.Addr().String()
+	return t, mysqlCfg.FormatDSN(), nil
+}
+
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			// listener关闭
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	client, err := t.sshClient()
+	if err != nil {
+		return
+	}
+	remote, err := client.Dial("tcp", t.remote)
+	if err != nil {
+		t.reset(client)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// sshClient returns the SSH connection, dialing it again if it dropped.
+func (t *sshTunnel) sshClient() (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	client, err := ssh.Dial("tcp", t.cfg.Addr, &ssh.ClientConfig{
+		User:            t.cfg.User,
+		Auth:            t.cfg.Auth,
+		HostKeyCallback: t.cfg.HostKeyCallback,
+		Timeout:         _sshDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.client = client
+	go t.keepAlive(client)
+	return client, nil
+}
+
+// keepAlive detects dropped SSH connections, including silently dead ones.
+func (t *sshTunnel) keepAlive(client *ssh.Client) {
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(_sshKeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			t.reset(client)
+			return
+		case <-ticker.C:
+			if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				t.reset(client)
+				return
+			}
+		}
+	}
+}
+
+// reset drops client so that the next connection dials SSH again.
+func (t *sshTunnel) reset(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == client {
+		t.client = nil
+		_ = client.Close()
+	}
+}
+
+func (t *sshTunnel) Close() error {
+	err := t.listener.Close()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		_ = t.client.Close()
+		t.client = nil
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package gorm
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_statsQueries  = "queries"
+	_statsErrors   = "errors"
+	_statsDuration = "query.duration"
+	_statsSlow     = "slow_queries"
+)
+
+// StatsSink receives the same timing and counter data as the OpenTelemetry metrics,
+// tags are "key:value" pairs. Implementations must be safe for concurrent use and should not block.
+type StatsSink interface {
+	Timing(name string, d time.Duration, tags []string)
+	Count(name string, n int64, tags []string)
+}
+
+// StatsD is a StatsSink sending metrics over UDP, tags are only sent in the DogStatsD format.
+type StatsD struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool
+}
+
+// NewStatsD dials the StatsD agent at addr, every metric name is prefixed with prefix.
+// Set dogstatsd to send tags with the DogStatsD "|#tag" extension.
+func NewStatsD(addr, prefix string, dogstatsd bool) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	return &StatsD{conn: conn, prefix: prefix, dogstatsd: dogstatsd}, nil
+}
+
+func (s *StatsD) Timing(name string, d time.Duration, tags []string) {
+	s.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64), "ms", tags)
+}
+
+func (s *StatsD) Count(name string, n int64, tags []string) {
+	s.send(name, strconv.FormatInt(n, 10), "c", tags)
+}
+
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsD) send(name, value, typ string, tags []string) {
+	if !s.dogstatsd {
+		tags = nil
+	}
+	// UDP发送失败直接丢弃，不影响业务
+	_, _ = s.conn.Write([]byte(statsdPacket(s.prefix+name, value, typ, tags)))
+}
+
+// statsdPacket formats a single metric line, e.g. "gorm.queries:1|c|#operation:SELECT".
+func statsdPacket(name, value, typ string, tags []string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(typ)
+	if len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+
+	return b.String()
+}
+
+func (op *OpentracingPlugin) recordStats(operation, table, status string, cost time.Duration) {
+	sink := op.opt.statsSink
+	tags := []string{"operation:" + operation, "status:" + status}
+	if table != "" {
+		tags = append(tags, "table:"+table)
+	}
+	if op.opt.connectionName != "" {
+		tags = append(tags, "connection:"+op.opt.connectionName)
+	}
+
+	sink.Count(_statsQueries, 1, tags)
+	sink.Timing(_statsDuration, cost, tags)
+	if status == _statusError {
+		sink.Count(_statsErrors, 1, tags)
+	}
+	if op.isSlow(cost) {
+		sink.Count(_statsSlow, 1, tags)
+	}
+}
@@ -0,0 +1,29 @@
+package gorm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatsdPacket(t *testing.T) {
+	type input struct {
+		name, value, typ string
+		tags             string
+	}
+	testSuites := map[input]string{
+		{"gorm.queries", "1", "c", ""}:                                "gorm.queries:1|c",
+		{"gorm.query.duration", "1.5", "ms", ""}:                      "gorm.query.duration:1.5|ms",
+		{"gorm.queries", "1", "c", "operation:SELECT,status:ok"}:      "gorm.queries:1|c|#operation:SELECT,status:ok",
+		{"errors", "2", "c", "operation:INSERT,status:error,table:t"}: "errors:2|c|#operation:INSERT,status:error,table:t",
+	}
+
+	for in, expected := range testSuites {
+		var tags []string
+		if in.tags != "" {
+			tags = strings.Split(in.tags, ",")
+		}
+		if got := statsdPacket(in.name, in.value, in.typ, tags); got != expected {
+			t.Errorf("statsdPacket %v, expects %v, but got %v", in, expected, got)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+const (
+	_dbTenantKey = attribute.Key("db.tenant")
+
+	_tenantPrefix = "tenant/"
+)
+
+var ErrNoTenantResolver = errors.New("gorm: no tenant resolver registered")
+
+// TenantResolver returns the DSN of the database of a tenant. For schema per tenant
+// setups it returns the shared server with the tenant schema, e.g. the database name
+// for MySQL or search_path for Postgres.
+type TenantResolver func(ctx context.Context, tenantID string) (string, error)
+
+type tenantConfig struct {
+	driver   Driver
+	resolver TenantResolver
+	opts     []ConnOption
+	open     *lru
+}
+
+// tenants is the registered tenant resolution, guarded by rwl.
+var tenants *tenantConfig
+
+// SetTenantResolver configures GetForTenant. At most maxOpen tenant pools are kept open,
+// opening one more evicts the least recently used one, whose pool is closed once every
+// GetForTenant of it is released and its running statements finish. maxOpen <= 0 keeps
+// every tenant pool open.
+func SetTenantResolver(driver Driver, resolver TenantResolver, maxOpen int, opts ...ConnOption) {
+	rwl.Lock()
+	defer rwl.Unlock()
+
+	tenants = &tenantConfig{driver: driver, resolver: resolver, opts: opts, open: newLRU(maxOpen)}
+}
+
+// GetForTenant returns the pool of tenantID, resolving its DSN and opening it on first
+// use, and the func releasing it. The pool stays open until released like with Acquire,
+// eviction waits up to 30s for it. The pool is registered as "tenant/<tenantID>" and its
+// spans are tagged with db.tenant.
+func GetForTenant(ctx context.Context, tenantID string) (*gorm.DB, func(), error) {
+	rwl.RLock()
+	tc := tenants
+	rwl.RUnlock()
+	if tc == nil {
+		return nil, nil, ErrNoTenantResolver
+	}
+
+	name := _tenantPrefix + tenantID
+	for {
+		if _, ok := registered(name); !ok {
+			dsn, err := tc.resolver(ctx, tenantID)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			opts := make([]ConnOption, 0, len(tc.opts)+1)
+			opts = append(opts, tc.opts...)
+			opts = append(opts, WithPluginOptions(WithAttributes(_dbTenantKey.String(tenantID))))
+			if _, err = open(ctx, name, &connection{driver: tc.driver, dsn: dsn, opts: opts}); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		if db, ok := tc.acquire(name); ok {
+			var once sync.Once
+			return db, func() { once.Do(func() { Release(db) }) }, nil
+		}
+		// 打开后被其他租户挤出, 重新打开
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// acquire acquires the pool of name and marks it most recently used, evicting the least
+// recently used tenant pools. Both happen under rwl, so that an evicted name isn't marked
+// used again while it is missing from the registry.
+func (tc *tenantConfig) acquire(name string) (*gorm.DB, bool) {
+	rwl.Lock()
+	c, ok := dbs[name]
+	if !ok {
+		rwl.Unlock()
+		return nil, false
+	}
+	refMu.Lock()
+	refs[c.db]++
+	refMu.Unlock()
+	c.touch(time.Now())
+
+	victims := map[string]*connection{}
+	for _, victim := range tc.open.touch(name) {
+		if vc, ok := dbs[victim]; ok {
+			delete(dbs, victim)
+			victims[victim] = vc
+		}
+	}
+	rwl.Unlock()
+
+	for victim, vc := range victims {
+		go vc.drain()
+		emit(EventEvicted, victim, nil)
+	}
+	return c.db, true
+}
@@ -0,0 +1,49 @@
+package gorm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetForTenantEviction(t *testing.T) {
+	SetTenantResolver(DriverSQLite, func(_ context.Context, tenantID string) (string, error) {
+		return "file:tenant_" + tenantID + "?mode=memory&cache=shared", nil
+	}, 1)
+	defer func() {
+		rwl.Lock()
+		tenants = nil
+		rwl.Unlock()
+		_ = Close(_tenantPrefix + "a")
+		_ = Close(_tenantPrefix + "b")
+	}()
+
+	ctx := context.Background()
+	a, releaseA, err := GetForTenant(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetForTenant a, expects no error, but got %v", err)
+	}
+	// 打开b挤出a, a仍被持有
+	_, releaseB, err := GetForTenant(ctx, "b")
+	if err != nil {
+		t.Fatalf("GetForTenant b, expects no error, but got %v", err)
+	}
+	defer releaseB()
+	if _, ok := Lookup(_tenantPrefix + "a"); ok {
+		t.Errorf("Lookup evicted tenant, expects %v, but got %v", false, ok)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if err = a.Exec("SELECT 1").Error; err != nil {
+		t.Errorf("Exec on held tenant pool, expects no error, but got %v", err)
+	}
+
+	releaseA()
+	deadline := time.Now().Add(5 * time.Second)
+	for a.Exec("SELECT 1").Error == nil && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err = a.Exec("SELECT 1").Error; err == nil {
+		t.Errorf("Exec on released evicted pool, expects an error, but got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package gorm
+
+import (
+	"crypto/tls"
+	"errors"
+
+	gomysql "github.com/go-sql-driver/mysql"
+)
+
+var ErrTLSUnsupported = errors.New("gorm: WithTLS is only supported by the mysql driver")
+
+// WithTLS registers cfg with the MySQL driver under name and connects with tls=name,
+// e.g. to pin the RDS or Cloud SQL CA.
+func WithTLS(name string, cfg *tls.Config) ConnOption {
+	return func(o *connOptions) {
+		if err := gomysql.RegisterTLSConfig(name, cfg); err != nil {
+			o.err = err
+			return
+		}
+		o.tlsConfig = name
+	}
+}
+
+// withTLSConfig sets the tls parameter of a MySQL DSN to a registered config.
+func withTLSConfig(dsn, name string) (string, error) {
+	cfg, err := gomysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+
+	cfg.TLSConfig = name
+	return cfg.FormatDSN(), nil
+}
@@ -0,0 +1,88 @@
+package gorm
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// traceLogger prefixes every line of the wrapped gorm logger with the ids of the span of
+// the statement, or else of the span active in ctx, so that logs can be searched by trace.
+type traceLogger struct {
+	logger.Interface
+}
+
+// NewTraceLogger wraps a gorm logger, e.g. logger.Default, adding trace_id and span_id
+// to each line as "trace_id=... span_id=...".
+//
+//	db, err := gorm.Open(dialector, &gorm.Config{Logger: NewTraceLogger(logger.Default)})
+func NewTraceLogger(l logger.Interface) logger.Interface {
+	return &traceLogger{Interface: l}
+}
+
+func (t *traceLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &traceLogger{Interface: t.Interface.LogMode(level)}
+}
+
+func (t *traceLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	t.Interface.Info(ctx, tracePrefix(ctx)+msg, data...)
+}
+
+func (t *traceLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	t.Interface.Warn(ctx, tracePrefix(ctx)+msg, data...)
+}
+
+func (t *traceLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	t.Interface.Error(ctx, tracePrefix(ctx)+msg, data...)
+}
+
+func (t *traceLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	prefix := tracePrefix(ctx)
+	if prefix == "" {
+		t.Interface.Trace(ctx, begin, fc, err)
+		return
+	}
+
+	// gorm的logger只在需要输出时才调用fc, 在SQL前加上前缀
+	t.Interface.Trace(ctx, begin, func() (string, int64) {
+		sql, rows := fc()
+		return prefix + sql, rows
+	}, err)
+}
+
+// statementSpanKey carries the span context of the statement, gorm logs it after the
+// plugin restored the context of the parent span.
+type statementSpanKey struct{}
+
+// withStatementSpan keeps the span context of the statement on its restored context. A
+// statement without span overrides the one of a previous statement reusing it.
+func withStatementSpan(db *gorm.DB, span trace.Span, ok bool) {
+	var sc trace.SpanContext
+	if ok {
+		sc = span.SpanContext()
+	}
+	if sc.IsValid() || db.Statement.Context.Value(statementSpanKey{}) != nil {
+		db.Statement.Context = context.WithValue(db.Statement.Context, statementSpanKey{}, sc)
+	}
+}
+
+// statementSpanIDs returns the ids of the span of the statement logged under ctx, or else
+// of the span active in ctx.
+func statementSpanIDs(ctx context.Context) (traceID, spanID string, ok bool) {
+	if sc, _ := ctx.Value(statementSpanKey{}).(trace.SpanContext); sc.IsValid() {
+		return sc.TraceID().String(), sc.SpanID().String(), true
+	}
+	return spanIDs(ctx)
+}
+
+func tracePrefix(ctx context.Context) string {
+	traceID, spanID, ok := statementSpanIDs(ctx)
+	if !ok {
+		return ""
+	}
+
+	return _traceIDField + "=" + traceID + " " + _spanIDField + "=" + spanID + " "
+}
@@ -0,0 +1,88 @@
+package gorm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// idTracer starts no-op spans with valid and distinct span contexts.
+type idTracer struct {
+	mu    sync.Mutex
+	spans []trace.SpanContext
+}
+
+func (t *idTracer) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return t
+}
+
+func (t *idTracer) Start(ctx context.Context, _ string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{byte(len(t.spans) + 1)},
+		TraceFlags: trace.FlagsSampled,
+	})
+	t.spans = append(t.spans, sc)
+	span := &idSpan{Span: trace.SpanFromContext(context.Background()), sc: sc}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type idSpan struct {
+	trace.Span
+	sc trace.SpanContext
+}
+
+func (s *idSpan) SpanContext() trace.SpanContext {
+	return s.sc
+}
+
+// sqlLogger keeps the statements gorm logs.
+type sqlLogger struct {
+	logger.Interface
+	sqls []string
+}
+
+func (l *sqlLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+func (l *sqlLogger) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	l.sqls = append(l.sqls, sql)
+}
+
+func TestTraceLoggerStatementSpan(t *testing.T) {
+	tracer, logs := &idTracer{}, &sqlLogger{Interface: logger.Discard}
+	db, err := gorm.Open(sqlite.Open("file:tracelogger?mode=memory&cache=shared"), &gorm.Config{Logger: NewTraceLogger(logs)})
+	if err != nil {
+		t.Fatalf("gorm.Open, expects no error, but got %v", err)
+	}
+	if err = db.Use(New(WithTracer(tracer))); err != nil {
+		t.Fatalf("Use, expects no error, but got %v", err)
+	}
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	logs.sqls = nil
+	if err = db.WithContext(ctx).Exec("SELECT 1").Error; err != nil {
+		t.Fatalf("Exec, expects no error, but got %v", err)
+	}
+
+	statement := tracer.spans[len(tracer.spans)-1]
+	if statement.Equal(parent.SpanContext()) || len(logs.sqls) != 1 {
+		t.Fatalf("Exec, expects 1 logged statement with its own span, but got %v", logs.sqls)
+	}
+	expected := _spanIDField + "=" + statement.SpanID().String() + " "
+	if !strings.Contains(logs.sqls[0], expected) {
+		t.Errorf("logged statement, expects %v, but got %v", expected, logs.sqls[0])
+	}
+}
@@ -0,0 +1,227 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	_txCommitEvent            = "commit"
+	_txCommitFailedEvent      = "commit_failed"
+	_txRollbackEvent          = "rollback"
+	_txSavepointEvent         = "savepoint"
+	_txRollbackSavepointEvent = "rollback_to_savepoint"
+)
+
+var (
+	_txNestedKey    = keyWithPrefix("transaction.nested")
+	_txSavepointKey = keyWithPrefix("transaction.savepoint")
+)
+
+// Transaction runs fc in a transaction traced as a single parent span, statements
+// executed by tx become its children. Falls back to db.Transaction if the plugin is
+// not registered on db. Transaction metrics cover it and the transactions gorm wraps
+// writes in, db.Transaction and db.Begin called directly aren't seen by the plugin.
+func Transaction(ctx context.Context, db *gorm.DB, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	ctx, committed := withCommitHooks(ctx)
+	err := transaction(ctx, db, fc, opts...)
+	if err == nil {
+		committed()
+	}
+	return err
+}
+
+func transaction(ctx context.Context, db *gorm.DB, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
+	op, ok := lookupPlugin(db)
+	if !ok {
+		return db.WithContext(ctx).Transaction(fc, opts...)
+	}
+	if !op.tracing(ctx) {
+		f := &txFunc{fc: fc}
+		start := time.Now()
+		err := db.WithContext(ctx).Transaction(f.run, opts...)
+		if !isNestedTransaction(db) {
+			op.recordTxMetrics(ctx, time.Since(start), err, f.commitFailed(err))
+		}
+		return err
+	}
+
+	return op.transaction(ctx, db, fc, opts...)
+}
+
+type commitHooksKey struct{}
+
+// commitHooks run once the outermost Transaction commits, e.g. to invalidate the cached
+// results of the tables it wrote.
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// withCommitHooks returns ctx carrying the hooks of its outermost Transaction, and the
+// function running them after commit, a no-op in nested transactions.
+func withCommitHooks(ctx context.Context) (context.Context, func()) {
+	if _, ok := ctx.Value(commitHooksKey{}).(*commitHooks); ok {
+		return ctx, func() {}
+	}
+
+	hooks := &commitHooks{}
+	return context.WithValue(ctx, commitHooksKey{}, hooks), hooks.run
+}
+
+// afterCommit defers fn until the Transaction of ctx commits, it reports false if ctx
+// doesn't belong to one.
+func afterCommit(ctx context.Context, fn func()) bool {
+	hooks, ok := ctx.Value(commitHooksKey{}).(*commitHooks)
+	if !ok {
+		return false
+	}
+
+	hooks.mu.Lock()
+	hooks.fns = append(hooks.fns, fn)
+	hooks.mu.Unlock()
+	return true
+}
+
+func (h *commitHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// txFunc runs fc, telling a failed commit from a rollback because fc failed.
+type txFunc struct {
+	fc  func(tx *gorm.DB) error
+	ran bool
+	err error
+}
+
+func (f *txFunc) run(tx *gorm.DB) error {
+	f.ran = true
+	f.err = f.fc(tx)
+	return f.err
+}
+
+// commitFailed reports whether err of the transaction running f comes from its commit.
+func (f *txFunc) commitFailed(err error) bool {
+	return err != nil && f.ran && f.err == nil
+}
+
+func (op *OpentracingPlugin) transaction(ctx context.Context, db *gorm.DB, fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) (err error) {
+	ctx, span := op.tracer.Start(ctx, _transactionOp.String(), trace.WithSpanKind(op.opt.spanKind))
+
+	span.SetAttributes(op.dbSystem)
+	span.SetAttributes(op.opt.semconv.dbName.String(db.Name()))
+	if len(op.serverAttrs) > 0 {
+		span.SetAttributes(op.serverAttrs...)
+	}
+	if op.opt.connectionName != "" {
+		span.SetAttributes(_connectionNameKey.String(op.opt.connectionName))
+	}
+	if len(op.opt.attrs) > 0 {
+		span.SetAttributes(op.opt.attrs...)
+	}
+
+	// 嵌套事务由gorm用savepoint实现, 名称与db.Transaction保持一致
+	f := &txFunc{fc: fc}
+	run := f.run
+	nested := isNestedTransaction(db)
+	savepoint := fmt.Sprintf("sp%p", run)
+	if nested {
+		span.SetAttributes(attribute.Bool(_txNestedKey, true), attribute.String(_txSavepointKey, savepoint))
+		span.AddEvent(_txSavepointEvent)
+	}
+
+	start := time.Now()
+	defer func() {
+		cost := time.Since(start)
+		span.SetAttributes(attribute.Int64(_txDurationKey, cost.Milliseconds()))
+		span.End()
+		if !nested {
+			op.recordTxMetrics(ctx, cost, err, f.commitFailed(err))
+		}
+	}()
+
+	if err = db.WithContext(ctx).Transaction(run, opts...); err != nil {
+		switch {
+		case nested:
+			span.AddEvent(_txRollbackSavepointEvent)
+		case f.commitFailed(err):
+			span.AddEvent(_txCommitFailedEvent)
+		default:
+			span.AddEvent(_txRollbackEvent)
+		}
+		if op.isSpanError(err) {
+			op.opt.errorTagHook(span, err)
+		}
+		return err
+	}
+
+	if !nested {
+		span.AddEvent(_txCommitEvent)
+	}
+	return nil
+}
+
+const (
+	_txStartInstance  = "tx_start"
+	_txFailedInstance = "tx_failed"
+)
+
+// beforeBeginTx, beforeCommitTx and afterCommitTx record the transactions gorm wraps
+// creates, updates and deletes in, unless SkipDefaultTransaction is set.
+func (op *OpentracingPlugin) beforeBeginTx(db *gorm.DB) {
+	db.InstanceSet(_txStartInstance, time.Now())
+}
+
+func (op *OpentracingPlugin) beforeCommitTx(db *gorm.DB) {
+	db.InstanceSet(_txFailedInstance, db.Error != nil)
+}
+
+func (op *OpentracingPlugin) afterCommitTx(db *gorm.DB) {
+	if _, started := db.InstanceGet("gorm:started_transaction"); !started {
+		return
+	}
+	v, _ := db.InstanceGet(_txStartInstance)
+	start, ok := v.(time.Time)
+	if !ok {
+		return
+	}
+	db.InstanceSet(_txStartInstance, nil)
+
+	// 写入成功而提交失败
+	failed, _ := db.InstanceGet(_txFailedInstance)
+	op.recordTxMetrics(db.Statement.Context, time.Since(start), db.Error, failed != true && db.Error != nil)
+}
+
+// isNestedTransaction reports whether a transaction on db is nested in an outer one.
+func isNestedTransaction(db *gorm.DB) bool {
+	committer, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok && committer != nil && !db.DisableNestedTransaction
+}
+
+// SavePoint creates a savepoint on tx, recording it as an event of the current span.
+func SavePoint(ctx context.Context, tx *gorm.DB, name string) error {
+	err := tx.WithContext(ctx).SavePoint(name).Error
+	trace.SpanFromContext(ctx).AddEvent(_txSavepointEvent, trace.WithAttributes(attribute.String(_txSavepointKey, name)))
+	return err
+}
+
+// RollbackTo rolls tx back to a savepoint, recording it as an event of the current span.
+func RollbackTo(ctx context.Context, tx *gorm.DB, name string) error {
+	err := tx.WithContext(ctx).RollbackTo(name).Error
+	trace.SpanFromContext(ctx).AddEvent(_txRollbackSavepointEvent, trace.WithAttributes(attribute.String(_txSavepointKey, name)))
+	return err
+}
@@ -0,0 +1,85 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	_defaultTxAttempts = 3
+	_defaultTxInitial  = 10 * time.Millisecond
+	_defaultTxMax      = time.Second
+)
+
+var _txAttemptKey = keyWithPrefix("transaction.attempt")
+
+// TxRetryOptions configures RetryTransaction, zero values use the defaults.
+type TxRetryOptions struct {
+	// MaxAttempts is the number of times fc runs at most, 3 by default.
+	MaxAttempts int
+	// Initial and Max bound the jittered wait between attempts, doubling from 10ms up to
+	// 1s by default.
+	Initial time.Duration
+	Max     time.Duration
+	// TxOptions are passed to the transaction, e.g. the isolation level.
+	TxOptions *sql.TxOptions
+}
+
+// RetryTransaction is Transaction rerunning fc in a new transaction when it fails with a
+// deadlock or serialization failure, which abort the whole transaction. fc must not have
+// side effects outside the database. Each attempt is a transaction span carrying its
+// attempt number. Nested transactions run once, the outer one has to be retried.
+func RetryTransaction(ctx context.Context, db *gorm.DB, fc func(tx *gorm.DB) error, opts TxRetryOptions) error {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = _defaultTxAttempts
+	}
+	if opts.Initial <= 0 {
+		opts.Initial = _defaultTxInitial
+	}
+	if opts.Max <= 0 {
+		opts.Max = _defaultTxMax
+	}
+	var txOpts []*sql.TxOptions
+	if opts.TxOptions != nil {
+		txOpts = append(txOpts, opts.TxOptions)
+	}
+	if isNestedTransaction(db) {
+		opts.MaxAttempts = 1
+	}
+
+	b := backoff{initial: opts.Initial, max: opts.Max}
+	for attempt := 1; ; attempt++ {
+		err := Transaction(ctx, db, func(tx *gorm.DB) error {
+			trace.SpanFromContext(tx.Statement.Context).SetAttributes(attribute.Int(_txAttemptKey, attempt))
+			return fc(tx)
+		}, txOpts...)
+		if err == nil || attempt >= opts.MaxAttempts || !isTxConflict(err) {
+			return err
+		}
+		if serr := sleep(ctx, jitter(b.delay(attempt))); serr != nil {
+			return err
+		}
+	}
+}
+
+// isTxConflict reports errors aborting a transaction that a rerun may not hit again.
+func isTxConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// serialization_failure, deadlock_detected
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+
+	switch classifyError(err) {
+	case ErrClassDeadlock, ErrClassLockWaitTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	gomysql "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// txPool is a ConnPool whose transactions only count commits and rollbacks, enough for
+// db.Transaction to run without a database.
+type txPool struct {
+	commits   int
+	rollbacks int
+}
+
+func (p *txPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (p *txPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (p *txPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (p *txPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func (p *txPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return &txConn{txPool: p}, nil
+}
+
+type txConn struct {
+	*txPool
+}
+
+func (tx *txConn) Commit() error {
+	tx.commits++
+	return nil
+}
+
+func (tx *txConn) Rollback() error {
+	tx.rollbacks++
+	return nil
+}
+
+type txDialector struct {
+	pool *txPool
+}
+
+func (d txDialector) Name() string {
+	return "tx"
+}
+
+func (d txDialector) Initialize(db *gorm.DB) error {
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (d txDialector) Migrator(*gorm.DB) gorm.Migrator {
+	return nil
+}
+
+func (d txDialector) DataTypeOf(*schema.Field) string {
+	return ""
+}
+
+func (d txDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return nil
+}
+
+func (d txDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	_ = writer.WriteByte('?')
+}
+
+func (d txDialector) QuoteTo(writer clause.Writer, str string) {
+	_, _ = writer.WriteString(str)
+}
+
+func (d txDialector) Explain(sql string, _ ...interface{}) string {
+	return sql
+}
+
+func (d txDialector) SavePoint(*gorm.DB, string) error {
+	return nil
+}
+
+func (d txDialector) RollbackTo(*gorm.DB, string) error {
+	return nil
+}
+
+// attrSpan records the attributes set on it.
+type attrSpan struct {
+	trace.Span
+	attrs []attribute.KeyValue
+}
+
+func (s *attrSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.attrs = append(s.attrs, kv...)
+}
+
+func openTxDB(t *testing.T) (*gorm.DB, *txPool) {
+	pool := &txPool{}
+	db, err := gorm.Open(txDialector{pool: pool}, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm.Open, expects no error, but got %v", err)
+	}
+	return db, pool
+}
+
+func TestRetryTransaction(t *testing.T) {
+	opts := TxRetryOptions{Initial: 1, Max: 1}
+	testSuites := map[error]int{
+		&pgconn.PgError{Code: "40001"}:    3,
+		&pgconn.PgError{Code: "40P01"}:    3,
+		&gomysql.MySQLError{Number: 1213}: 3,
+		&pgconn.PgError{Code: "23505"}:    1,
+		&gomysql.MySQLError{Number: 1062}: 1,
+	}
+
+	for conflict, expected := range testSuites {
+		db, pool := openTxDB(t)
+		runs := 0
+		err := RetryTransaction(context.Background(), db, func(tx *gorm.DB) error {
+			if runs++; runs < 3 {
+				return conflict
+			}
+			return nil
+		}, opts)
+
+		if runs != expected {
+			t.Errorf("RetryTransaction on %v, expects %v runs, but got %v", conflict, expected, runs)
+		}
+		if expected == 3 && (err != nil || pool.commits != 1 || pool.rollbacks != 2) {
+			t.Errorf("RetryTransaction on %v, expects 1 commit 2 rollbacks, but got %v %v, %v", conflict, pool.commits, pool.rollbacks, err)
+		}
+		if expected == 1 && err != conflict {
+			t.Errorf("RetryTransaction on %v, expects %v, but got %v", conflict, conflict, err)
+		}
+	}
+}
+
+func TestRetryTransactionMaxAttempts(t *testing.T) {
+	db, pool := openTxDB(t)
+	conflict := &pgconn.PgError{Code: "40001"}
+
+	runs := 0
+	err := RetryTransaction(context.Background(), db, func(tx *gorm.DB) error {
+		runs++
+		return conflict
+	}, TxRetryOptions{MaxAttempts: 2, Initial: 1, Max: 1})
+
+	if err != conflict || runs != 2 || pool.rollbacks != 2 {
+		t.Errorf("RetryTransaction, expects %v after %v runs, but got %v after %v", conflict, 2, err, runs)
+	}
+}
+
+func TestRetryTransactionNested(t *testing.T) {
+	db, _ := openTxDB(t)
+	conflict := &pgconn.PgError{Code: "40001"}
+
+	runs := 0
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		return RetryTransaction(context.Background(), tx, func(tx *gorm.DB) error {
+			runs++
+			return conflict
+		}, TxRetryOptions{Initial: 1, Max: 1})
+	})
+
+	if runs != 1 {
+		t.Errorf("nested RetryTransaction, expects %v runs, but got %v", 1, runs)
+	}
+}
+
+func TestRetryTransactionAttempt(t *testing.T) {
+	db, _ := openTxDB(t)
+	span := &attrSpan{Span: trace.SpanFromContext(context.Background())}
+	ctx := trace.ContextWithSpan(context.Background(), span)
+
+	runs := 0
+	err := RetryTransaction(ctx, db, func(tx *gorm.DB) error {
+		if runs++; runs < 2 {
+			return &gomysql.MySQLError{Number: 1213}
+		}
+		return nil
+	}, TxRetryOptions{Initial: 1, Max: 1})
+	if err != nil {
+		t.Fatalf("RetryTransaction, expects no error, but got %v", err)
+	}
+
+	var attempts []int64
+	for _, kv := range span.attrs {
+		if kv.Key == attribute.Key(_txAttemptKey) {
+			attempts = append(attempts, kv.Value.AsInt64())
+		}
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 {
+		t.Errorf("attempt attributes, expects %v, but got %v", []int64{1, 2}, attempts)
+	}
+}
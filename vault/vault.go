@@ -0,0 +1,213 @@
+// Package vault opens registry connections with dynamic credentials of the Vault
+// database secrets engine, renewing their lease and rebuilding the pool with new
+// credentials when it can't be renewed any more.
+package vault
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	registry "github.com/go-grom/gorm"
+	"github.com/hashicorp/vault/api"
+	"gorm.io/gorm"
+)
+
+const (
+	_defaultMount = "database"
+
+	// _retryDelay 轮换失败后的重试间隔, 旧凭据在吊销前仍然可用
+	_retryDelay = 5 * time.Second
+	// _revokeTimeout 吊销未使用租约的超时
+	_revokeTimeout = 5 * time.Second
+)
+
+var (
+	ErrNoCredentials = errors.New("vault: secret has no username or password")
+	ErrRegistered    = errors.New("vault: name is already registered")
+)
+
+// Config selects the role of the database secrets engine a connection gets its
+// credentials from.
+type Config struct {
+	Client *api.Client
+	// Mount is the path the secrets engine is mounted at, "database" by default.
+	Mount string
+	Role  string
+	// DSN formats the DSN of the database with leased credentials.
+	DSN func(username, password string) string
+	// OnError is called when a lease can't be renewed or credentials can't be rotated,
+	// rotation is retried every 5s while the previous credentials keep working.
+	OnError func(err error)
+}
+
+// Rotator keeps the credentials of a registered connection valid until Close, or until
+// the connection is closed with registry.Close.
+type Rotator struct {
+	name   string
+	cfg    Config
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Register opens name with credentials leased from Vault and keeps them valid: the lease
+// is renewed while Vault allows it, then new credentials are leased and the pool is
+// rebuilt with them by registry.Replace. Get the current pool with DB or
+// registry.Lookup rather than keeping it, the old one is closed after rotation.
+// Names registered already return ErrRegistered.
+func Register(ctx context.Context, name string, driver registry.Driver, cfg Config, opts ...registry.ConnOption) (*Rotator, error) {
+	if cfg.Mount == "" {
+		cfg.Mount = _defaultMount
+	}
+	if _, ok := registry.Lookup(name); ok {
+		return nil, ErrRegistered
+	}
+
+	secret, dsn, err := cfg.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = registry.GetWithDriver(ctx, name, driver, dsn, opts...); err != nil {
+		cfg.revoke(secret)
+		return nil, err
+	}
+	// 被淘汰后没有人能用租到的凭据重新打开
+	registry.Pin(name)
+
+	rctx, cancel := context.WithCancel(context.Background())
+	r := &Rotator{name: name, cfg: cfg, cancel: cancel, done: make(chan struct{})}
+	go r.run(rctx, secret)
+	return r, nil
+}
+
+// DB returns the current pool of the connection.
+func (r *Rotator) DB() (*gorm.DB, bool) {
+	return registry.Lookup(r.name)
+}
+
+// Close stops renewing and rotating, the connection stays registered until its
+// credentials are revoked.
+func (r *Rotator) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *Rotator) run(ctx context.Context, secret *api.Secret) {
+	defer close(r.done)
+
+	for {
+		if err := r.wait(ctx, secret); err != nil {
+			return
+		}
+
+		for {
+			next, err := r.rotate(ctx)
+			if err == nil {
+				secret = next
+				break
+			}
+			if errors.Is(err, registry.ErrNotFound) {
+				// 连接已关闭, 不再需要凭据
+				return
+			}
+			r.cfg.onError(err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(_retryDelay):
+			}
+		}
+	}
+}
+
+// wait renews the lease of secret until it can't be renewed any more, non renewable
+// leases are waited for two thirds of their duration. Leases without a duration don't
+// expire and are waited for until ctx is done.
+func (r *Rotator) wait(ctx context.Context, secret *api.Secret) error {
+	if secret.LeaseDuration <= 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if !secret.Renewable {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(secret.LeaseDuration) * time.Second * 2 / 3):
+			return nil
+		}
+	}
+
+	watcher, err := r.cfg.Client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		r.cfg.onError(err)
+		return nil
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.DoneCh():
+			// 租约到达最大TTL或续租失败, 需要新凭据
+			if err != nil {
+				r.cfg.onError(err)
+			}
+			return nil
+		case <-watcher.RenewCh():
+		}
+	}
+}
+
+func (r *Rotator) rotate(ctx context.Context) (*api.Secret, error) {
+	secret, dsn, err := r.cfg.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = registry.Replace(ctx, r.name, dsn); err != nil {
+		r.cfg.revoke(secret)
+		return nil, err
+	}
+	return secret, nil
+}
+
+// credentials leases new credentials and formats the DSN with them.
+func (c Config) credentials(ctx context.Context) (*api.Secret, string, error) {
+	secret, err := c.Client.Logical().ReadWithContext(ctx, c.Mount+"/creds/"+c.Role)
+	if err != nil {
+		return nil, "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, "", ErrNoCredentials
+	}
+
+	username, _ := secret.Data["username"].(string)
+	password, _ := secret.Data["password"].(string)
+	if username == "" || password == "" {
+		c.revoke(secret)
+		return nil, "", ErrNoCredentials
+	}
+	return secret, c.DSN(username, password), nil
+}
+
+// revoke revokes the lease of credentials that won't be used, so they don't stay valid
+// until the lease expires. ctx of the caller may be done already, e.g. after a timeout.
+func (c Config) revoke(secret *api.Secret) {
+	if secret.LeaseID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), _revokeTimeout)
+	defer cancel()
+	if err := c.Client.Sys().RevokeWithContext(ctx, secret.LeaseID); err != nil {
+		c.onError(err)
+	}
+}
+
+func (c Config) onError(err error) {
+	if c.OnError != nil {
+		c.OnError(err)
+	}
+}
@@ -0,0 +1,62 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// WithWarmUp establishes n connections in parallel once the pool is opened, so the first
+// burst of traffic doesn't pay for handshakes. n is capped at the max open connections of
+// the pool, and they stay idle only up to its max idle connections, 2 by default, see
+// WithMaxIdleConns. Ignored with WithLazy.
+func WithWarmUp(n int) ConnOption {
+	return func(o *connOptions) {
+		o.warmUp = n
+	}
+}
+
+// warmUp holds n connections at once so that the pool has to dial each of them, then
+// returns them to the pool. Failures are ignored, the pool dials again on demand.
+func warmUp(ctx context.Context, db *gorm.DB, n int) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return
+	}
+	// 超过最大连接数时Conn会一直等待
+	if limit := sqlDB.Stats().MaxOpenConnections; limit > 0 && n > limit {
+		n = limit
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make([]*sql.Conn, 0, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := sqlDB.Conn(ctx)
+			if err != nil {
+				return
+			}
+			if err = conn.PingContext(ctx); err != nil {
+				_ = conn.Close()
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,139 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ZapLogger writes both the plugin's logs (WithLogger) and gorm's own logs (gorm.Config.Logger)
+// to a zap.Logger, statements are logged with sql, duration, rows and trace_id fields.
+//
+//	l, err := NewZapProductionLogger(200 * time.Millisecond)
+//	db, err := gorm.Open(dialector, &gorm.Config{Logger: l})
+//	db.Use(New(WithLogger(l)))
+type ZapLogger struct {
+	l             *zap.Logger
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+// NewZapLogger logs statements slower than slowThreshold at WARN, zero disables it.
+func NewZapLogger(l *zap.Logger, slowThreshold time.Duration) *ZapLogger {
+	return &ZapLogger{l: l.WithOptions(zap.AddCallerSkip(1)), level: logger.Warn, slowThreshold: slowThreshold}
+}
+
+// ZapProductionConfig is zap's production config, sampling identical messages after the
+// first 100 per second to 1 in 100, so that a query loop can't flood the output.
+func ZapProductionConfig() zap.Config {
+	cfg := zap.NewProductionConfig()
+	cfg.Sampling = &zap.SamplingConfig{Initial: 100, Thereafter: 100}
+	return cfg
+}
+
+// NewZapProductionLogger builds a ZapLogger from ZapProductionConfig.
+func NewZapProductionLogger(slowThreshold time.Duration) (*ZapLogger, error) {
+	l, err := ZapProductionConfig().Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewZapLogger(l, slowThreshold), nil
+}
+
+func (z *ZapLogger) Debugf(ctx context.Context, format string, args ...interface{}) {
+	z.logf(ctx, zapcore.DebugLevel, format, args...)
+}
+
+func (z *ZapLogger) Infof(ctx context.Context, format string, args ...interface{}) {
+	z.logf(ctx, zapcore.InfoLevel, format, args...)
+}
+
+func (z *ZapLogger) Warnf(ctx context.Context, format string, args ...interface{}) {
+	z.logf(ctx, zapcore.WarnLevel, format, args...)
+}
+
+func (z *ZapLogger) Errorf(ctx context.Context, format string, args ...interface{}) {
+	z.logf(ctx, zapcore.ErrorLevel, format, args...)
+}
+
+func (z *ZapLogger) LogMode(level logger.LogLevel) logger.Interface {
+	c := *z
+	c.level = level
+	return &c
+}
+
+func (z *ZapLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if z.level >= logger.Info {
+		z.logf(ctx, zapcore.InfoLevel, msg, data...)
+	}
+}
+
+func (z *ZapLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if z.level >= logger.Warn {
+		z.logf(ctx, zapcore.WarnLevel, msg, data...)
+	}
+}
+
+func (z *ZapLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if z.level >= logger.Error {
+		z.logf(ctx, zapcore.ErrorLevel, msg, data...)
+	}
+}
+
+func (z *ZapLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if z.level <= logger.Silent {
+		return
+	}
+
+	cost := time.Since(begin)
+	level, msg := zapcore.DebugLevel, "[gorm] query"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && z.level >= logger.Error:
+		level, msg = zapcore.ErrorLevel, "[gorm] query failed"
+	case z.slowThreshold > 0 && cost > z.slowThreshold && z.level >= logger.Warn:
+		level, msg = zapcore.WarnLevel, "[gorm] slow query"
+	case z.level < logger.Info:
+		return
+	}
+
+	ce := z.l.Check(level, msg)
+	if ce == nil {
+		return
+	}
+
+	sql, rows := fc()
+	fields := append(z.traceFields(ctx),
+		zap.String("sql", sql),
+		zap.Duration("duration", cost),
+		zap.Int64("rows", rows),
+	)
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	ce.Write(fields...)
+}
+
+func (z *ZapLogger) logf(ctx context.Context, level zapcore.Level, format string, args ...interface{}) {
+	if !z.l.Core().Enabled(level) {
+		return
+	}
+	if ce := z.l.Check(level, fmt.Sprintf(format, args...)); ce != nil {
+		ce.Write(z.traceFields(ctx)...)
+	}
+}
+
+func (z *ZapLogger) traceFields(ctx context.Context) []zap.Field {
+	traceID, spanID, ok := spanIDs(ctx)
+	if !ok {
+		return nil
+	}
+
+	return []zap.Field{zap.String(_traceIDField, traceID), zap.String(_spanIDField, spanID)}
+}